@@ -0,0 +1,89 @@
+package revgrep
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// withinDates returns the positions in changes whose lines were committed
+// within SinceDate and UntilDate, using git blame on file. Lines not yet
+// committed are treated as committed now. Deleted lines, and new files,
+// where changes is nil or newFile is set, are returned unchanged. If git blame
+// fails, changes is returned unfiltered with the error.
+func (c Checker) withinDates(file string, changes []pos, newFile bool) ([]pos, error) {
+	if (c.SinceDate.IsZero() && c.UntilDate.IsZero()) || changes == nil || newFile {
+		return changes, nil
+	}
+	dates, err := gitBlameDates(file, c.RevisionTo, c.ReadOnlyGit)
+	if err != nil {
+		return changes, fmt.Errorf("could not filter %q by commit date: %s", file, err)
+	}
+
+	now := time.Now()
+	within := []pos{}
+	for _, p := range changes {
+		date, ok := dates[p.lineNo]
+		if !ok {
+			date = now
+		}
+		if !p.deleted && !c.SinceDate.IsZero() && date.Before(c.SinceDate) {
+			continue
+		}
+		if !p.deleted && !c.UntilDate.IsZero() && !date.Before(c.UntilDate) {
+			continue
+		}
+		within = append(within, p)
+	}
+	return within, nil
+}
+
+// gitBlameDates returns the commit date of each line, by line number, of
+// file at revision, or the working tree if revision is empty. If readOnly is
+// set, git is run as ReadOnlyGitPatch does.
+func gitBlameDates(file, revision string, readOnly bool) (map[int]time.Time, error) {
+	args := []string{"blame", "--line-porcelain"}
+	if revision != "" {
+		args = append(args, revision)
+	}
+	args = append(args, "--", file)
+
+	var stderr bytes.Buffer
+	cmd := gitCommand(readOnly, args)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error executing git blame: %s: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	var (
+		dates  = make(map[int]time.Time)
+		lineNo int
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "\t"):
+			// content of the line, which ends its entry
+			lineNo = 0
+		case lineNo == 0:
+			// <sha> <original line> <final line> [<lines in group>]
+			fields := strings.Fields(line)
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("unexpected git blame header: %q", line)
+			}
+			lineNo, _ = strconv.Atoi(fields[2])
+		case strings.HasPrefix(line, "committer-time "):
+			sec, err := strconv.ParseInt(line[15:], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected git blame committer-time: %q", line)
+			}
+			dates[lineNo] = time.Unix(sec, 0)
+		}
+	}
+	return dates, scanner.Err()
+}
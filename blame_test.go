@@ -0,0 +1,75 @@
+package revgrep
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckerCommitDates(t *testing.T) {
+	date := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	tests := []struct {
+		since, until time.Time
+		want         []int
+	}{
+		{time.Time{}, time.Time{}, []int{8, 9, 10}},
+		{date("2017-03-01"), time.Time{}, []int{9, 10}},
+		{time.Time{}, date("2017-03-01"), []int{8}},
+		{date("2017-01-01"), date("2018-01-01"), []int{8, 9}},
+		{date("2017-02-01"), date("2017-03-01"), nil},
+	}
+
+	for _, test := range tests {
+		prevwd, sample := setup(t, "14-commit-dates", "")
+
+		checker := Checker{
+			RevisionFrom: "HEAD~2",
+			SinceDate:    test.since,
+			UntilDate:    test.until,
+		}
+		issues, err := checker.Check(bytes.NewReader(sample), ioutil.Discard)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		var have []int
+		for _, issue := range issues {
+			have = append(have, issue.LineNo)
+		}
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("since %v until %v: unexpected lines: have %v want %v", test.since, test.until, have, test.want)
+		}
+		teardown(t, prevwd)
+	}
+}
+
+func TestCheckerCommitDatesBlameError(t *testing.T) {
+	prevwd, _ := setup(t, "14-commit-dates", "")
+	defer teardown(t, prevwd)
+
+	patch := `diff --git a/missing.go b/missing.go
+--- a/missing.go
++++ b/missing.go
+@@ -1,1 +1,2 @@
+ package main
++var x = 1
+`
+	checker := Checker{
+		Patch:     strings.NewReader(patch),
+		SinceDate: time.Now().Add(-time.Hour),
+	}
+	_, err := checker.Check(strings.NewReader("missing.go:2:5: x declared\n"), ioutil.Discard)
+	if err == nil || !strings.Contains(err.Error(), "missing.go") {
+		t.Errorf("unexpected error: have %v want git blame error for missing.go", err)
+	}
+}
@@ -0,0 +1,175 @@
+package revgrep
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// CacheKey returns a key identifying the results of Check, for a given
+// tool's output, such as to cache the results of a linter run with revgrep
+// as a post-processor and skip unchanged runs. The key is a hash of the
+// options, excluding Debug, CacheDir, and functions such as LineMatch, and
+// the commit SHAs of RevisionFrom and RevisionTo, resolved with git. If
+// RevisionTo isn't set, the patch of the working tree, and the names and
+// contents of untracked files, are also hashed. The key doesn't identify the
+// tool, which should be part of any cache key it's used in. Only git
+// repositories are supported, and an error is returned if Patch is set.
+func (c Checker) CacheKey() (string, error) {
+	if c.Patch != nil {
+		return "", errors.New("cache key can't be computed when Patch is set")
+	}
+	revs, err := gitRevisions(c.RevisionFrom, c.RevisionTo, c.ReadOnlyGit)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "from %s\nto %s\n", revs.From, revs.To)
+	if revs.To == "" {
+		patch, newFiles, err := c.gitPatch()
+		if err != nil {
+			return "", err
+		}
+		if patch != nil {
+			if _, err := io.Copy(h, patch); err != nil {
+				return "", err
+			}
+		}
+		for _, file := range newFiles {
+			b, err := ioutil.ReadFile(file)
+			if err != nil {
+				return "", fmt.Errorf("could not read new file: %s", err)
+			}
+			fmt.Fprintf(h, "new file %q %d\n%s", file, len(b), b)
+		}
+	}
+
+	// options which don't affect the results, or can't be hashed
+	c.Patch, c.Debug, c.CacheDir, c.Summary = nil, nil, "", nil
+	c.LineMatch, c.IssueSink, c.PostFilters, c.LineSplit = nil, nil, nil, nil
+	c.RevisionFrom, c.RevisionTo, c.lastCommit, c.wholeFiles, c.patchRead = "", "", nil, nil, false
+	fmt.Fprintf(h, "options %#v\n", c)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// gitPatch returns the patch between RevisionFrom and RevisionTo from
+// GitPatch, or ReadOnlyGitPatch if ReadOnlyGit is set.
+func (c Checker) gitPatch() (io.Reader, []string, error) {
+	if c.ReadOnlyGit {
+		return ReadOnlyGitPatch(c.RevisionFrom, c.RevisionTo)
+	}
+	return GitPatch(c.RevisionFrom, c.RevisionTo)
+}
+
+// cachePath returns the path of the cached patch between revs.
+func (c Checker) cachePath(revs Revisions) string {
+	return filepath.Join(c.CacheDir, revs.From+"-"+revs.To+".patch")
+}
+
+// readGitPatch sets Patch and NewFiles to the patch between RevisionFrom and
+// RevisionTo from git, once a git repository has been found, see vcsPatch,
+// and the options which only apply to git, such as OnlyLastCommit. The
+// revisions of the patch are returned, if resolved.
+func (c *Checker) readGitPatch() (revisions *Revisions, err error) {
+	if c.OnlyLastCommit && c.RevisionFrom != "" && c.RevisionTo == "" {
+		// uncommitted changes can't be in the last commit
+		c.RevisionTo = "HEAD"
+	}
+	if c.SquashAware && c.RevisionFrom != "" {
+		base, err := gitMergeBase(c.RevisionFrom, c.RevisionTo, c.ReadOnlyGit)
+		if err != nil {
+			c.debugf("could not find merge base, using %q: %s", c.RevisionFrom, err)
+		} else {
+			c.debugf("using merge base %q of %q", base, c.RevisionFrom)
+			c.RevisionFrom = base
+		}
+	}
+	if c.IncludeRevisionMetadata || c.Summary != nil {
+		revs, err := gitRevisions(c.RevisionFrom, c.RevisionTo, c.ReadOnlyGit)
+		if err != nil {
+			c.debugf("could not resolve revisions: %s", err)
+		} else {
+			revisions = &revs
+		}
+	}
+
+	if c.CacheDir != "" && c.RevisionFrom != "" && c.RevisionTo != "" {
+		c.Patch, err = c.cachedGitPatch()
+	} else {
+		c.Patch, c.NewFiles, err = c.gitPatch()
+	}
+	if err != nil || c.Patch == nil {
+		return revisions, err
+	}
+
+	if c.OnlyLastCommit && c.RevisionFrom != "" {
+		c.lastCommit, err = gitLastCommitChanges(c.RevisionTo, c.ReadOnlyGit)
+		if err != nil {
+			return revisions, fmt.Errorf("could not read last commit: %s", err)
+		}
+	}
+	return revisions, nil
+}
+
+// cachedGitPatch returns the patch between RevisionFrom and RevisionTo from
+// CacheDir, if found, else the patch is generated by GitPatch, or
+// ReadOnlyGitPatch, and stored in CacheDir. It's only used once a git
+// repository has been found, see readGitPatch.
+func (c Checker) cachedGitPatch() (io.Reader, error) {
+	revs, err := gitRevisions(c.RevisionFrom, c.RevisionTo, c.ReadOnlyGit)
+	if err != nil {
+		return nil, err
+	}
+	path := c.cachePath(revs)
+
+	if cached, err := ioutil.ReadFile(path); err == nil {
+		c.debugf("using cached patch: %q", path)
+		return bytes.NewReader(cached), nil
+	}
+
+	patch, _, err := c.gitPatch()
+	if err != nil || patch == nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	c.debugf("caching patch: %q", path)
+	if err := writeFileAtomic(path, b); err != nil {
+		c.debugf("could not cache patch: %s", err)
+	}
+	return bytes.NewReader(b), nil
+}
+
+// writeFileAtomic writes data to a temporary file, which is then renamed to
+// path, so concurrent readers never read a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("could not write %q: %s", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package revgrep
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckerCacheDir(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "revgrep")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	prevwd, sample := setup(t, "13-last-commit", "")
+	defer teardown(t, prevwd)
+
+	checker := Checker{
+		RevisionFrom: "HEAD~1",
+		RevisionTo:   "HEAD~0",
+		CacheDir:     cacheDir,
+	}
+
+	lines := func() []int {
+		issues, err := checker.Check(bytes.NewReader(sample), ioutil.Discard)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var lines []int
+		for _, issue := range issues {
+			lines = append(lines, issue.LineNo)
+		}
+		return lines
+	}
+
+	// cache miss
+	if have, want := lines(), []int{9}; !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected lines on miss: have %v want %v", have, want)
+	}
+
+	revs, err := GitRevisions(checker.RevisionFrom, checker.RevisionTo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	path := checker.cachePath(revs)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("patch was not cached: %v", err)
+	}
+
+	// cache hit, with a modified patch to detect it was used
+	patch := "--- a/main.go\n+++ b/main.go\n@@ -3,1 +3,1 @@\n+changed\n"
+	if err := ioutil.WriteFile(path, []byte(patch), 0644); err != nil {
+		t.Fatalf("could not write cache: %v", err)
+	}
+	if have, want := lines(), []int{3}; !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected lines on hit: have %v want %v", have, want)
+	}
+
+	// different revisions miss
+	checker.RevisionTo = "HEAD~1"
+	if have := lines(); have != nil {
+		t.Errorf("unexpected lines for different revisions: have %v", have)
+	}
+}
+
+func TestCheckerCacheDirOtherVCS(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "revgrep")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	RegisterVCS("other", VCSFunc(func(revisionFrom, revisionTo string) (io.Reader, []string, error) {
+		return strings.NewReader("--- a/main.go\n+++ b/main.go\n@@ -1,1 +1,2 @@\n line\n+added\n"), nil, nil
+	}))
+	defer func() {
+		vcsMu.Lock()
+		delete(vcses, "other")
+		vcsMu.Unlock()
+	}()
+
+	// the revisions aren't git's, and the patch isn't cached
+	checker := Checker{
+		VCSOrder:     []string{"other"},
+		RevisionFrom: "1",
+		RevisionTo:   "2",
+		CacheDir:     cacheDir,
+	}
+	issues, err := checker.Check(strings.NewReader("main.go:1: unchanged\nmain.go:2: added\n"), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(issues) != 1 || issues[0].LineNo != 2 {
+		t.Errorf("unexpected issues: %#v", issues)
+	}
+	if files, _ := ioutil.ReadDir(cacheDir); len(files) != 0 {
+		t.Errorf("unexpected cached files: %v", files)
+	}
+}
+
+func TestCheckerCacheKey(t *testing.T) {
+	prevwd, _ := setup(t, "13-last-commit", "")
+	defer teardown(t, prevwd)
+
+	key := func(checker Checker) string {
+		key, err := checker.CacheKey()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(key) != 64 {
+			t.Errorf("unexpected key: %q", key)
+		}
+		return key
+	}
+
+	base := key(Checker{RevisionFrom: "HEAD~1", RevisionTo: "HEAD"})
+	tests := []struct {
+		name    string
+		checker Checker
+		same    bool
+	}{
+		{"stable", Checker{RevisionFrom: "HEAD~1", RevisionTo: "HEAD"}, true},
+		{"same commits", Checker{RevisionFrom: "HEAD~1", RevisionTo: "HEAD~0"}, true},
+		{"debug", Checker{RevisionFrom: "HEAD~1", RevisionTo: "HEAD", Debug: ioutil.Discard}, true},
+		{"from", Checker{RevisionFrom: "HEAD~2", RevisionTo: "HEAD"}, false},
+		{"to", Checker{RevisionFrom: "HEAD~2", RevisionTo: "HEAD~1"}, false},
+		{"working tree", Checker{RevisionFrom: "HEAD~1"}, false},
+		{"options", Checker{RevisionFrom: "HEAD~1", RevisionTo: "HEAD", Tool: "vet"}, false},
+	}
+	for _, test := range tests {
+		if have := key(test.checker); (have == base) != test.same {
+			t.Errorf("%s: unexpected key equality %v, have %q base %q", test.name, have == base, have, base)
+		}
+	}
+
+	// uncommitted changes change the working tree's key
+	before := key(Checker{RevisionFrom: "HEAD~1"})
+	src, err := ioutil.ReadFile("main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("main.go", append(src, "// changed\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if after := key(Checker{RevisionFrom: "HEAD~1"}); after == before {
+		t.Error("expected key to change with uncommitted changes")
+	}
+
+	if _, err := (Checker{Patch: bytes.NewReader(nil)}).CacheKey(); err == nil {
+		t.Error("expected error when Patch is set")
+	}
+}
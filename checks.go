@@ -0,0 +1,57 @@
+package revgrep
+
+import "strings"
+
+// maxCheckAnnotations is the maximum number of annotations the GitHub Checks
+// API accepts per request.
+const maxCheckAnnotations = 50
+
+// Annotation is an annotation of a GitHub check run.
+//
+// See also: https://developer.github.com/v3/checks/runs/#annotations-object
+type Annotation struct {
+	Path            string `json:"path"`
+	StartLine       int    `json:"start_line"`
+	EndLine         int    `json:"end_line"`
+	StartColumn     int    `json:"start_column,omitempty"`
+	EndColumn       int    `json:"end_column,omitempty"`
+	AnnotationLevel string `json:"annotation_level"`
+	Message         string `json:"message"`
+}
+
+// IssuesToCheckAnnotations converts issues to GitHub check run annotations,
+// in batches of at most 50, the maximum accepted by each request to create or
+// update a check run. An issue's severity is mapped to the annotation level:
+// error to failure, info and notice to notice, and all others to warning.
+func IssuesToCheckAnnotations(issues []Issue) [][]Annotation {
+	var batches [][]Annotation
+	for i, issue := range issues {
+		if i%maxCheckAnnotations == 0 {
+			batches = append(batches, make([]Annotation, 0, maxCheckAnnotations))
+		}
+		annotation := Annotation{
+			Path:            issue.File,
+			StartLine:       issue.LineNo,
+			EndLine:         issue.LineNo,
+			AnnotationLevel: annotationLevel(issue.Severity),
+			Message:         issue.Message,
+		}
+		if issue.ColNo > 0 {
+			annotation.StartColumn = issue.ColNo
+			annotation.EndColumn = issue.ColNo
+		}
+		batches[len(batches)-1] = append(batches[len(batches)-1], annotation)
+	}
+	return batches
+}
+
+// annotationLevel returns the annotation level for severity.
+func annotationLevel(severity string) string {
+	switch strings.ToLower(severity) {
+	case "error":
+		return "failure"
+	case "info", "notice":
+		return "notice"
+	}
+	return "warning"
+}
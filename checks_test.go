@@ -0,0 +1,45 @@
+package revgrep
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestIssuesToCheckAnnotations(t *testing.T) {
+	var issues []Issue
+	for i := 1; i <= 120; i++ {
+		issues = append(issues, Issue{File: "file.go", LineNo: i, Message: fmt.Sprintf("issue %d", i)})
+	}
+	issues[0].ColNo = 5
+	issues[0].Severity = "error"
+	issues[1].Severity = "Info"
+	issues[2].Severity = "warning"
+
+	batches := IssuesToCheckAnnotations(issues)
+
+	var sizes []int
+	for _, batch := range batches {
+		sizes = append(sizes, len(batch))
+	}
+	if want := []int{50, 50, 20}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("unexpected batch sizes: have %v want %v", sizes, want)
+	}
+
+	want := []Annotation{
+		{Path: "file.go", StartLine: 1, EndLine: 1, StartColumn: 5, EndColumn: 5, AnnotationLevel: "failure", Message: "issue 1"},
+		{Path: "file.go", StartLine: 2, EndLine: 2, AnnotationLevel: "notice", Message: "issue 2"},
+		{Path: "file.go", StartLine: 3, EndLine: 3, AnnotationLevel: "warning", Message: "issue 3"},
+		{Path: "file.go", StartLine: 4, EndLine: 4, AnnotationLevel: "warning", Message: "issue 4"},
+	}
+	if have := batches[0][:4]; !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected annotations:\nhave: %#v\nwant: %#v", have, want)
+	}
+	if have := batches[2][19]; have.StartLine != 120 {
+		t.Errorf("unexpected last annotation: %#v", have)
+	}
+
+	if batches := IssuesToCheckAnnotations(nil); batches != nil {
+		t.Errorf("expected no batches, got: %v", batches)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/bradleyfalzon/revgrep"
+)
+
+// config is the options resolved from the flags, those of the Checker and
+// those only used by the command, as written by -print-config.
+type config struct {
+	revgrep.Checker
+	FailOn         string
+	InputFormat    string
+	Diff           string
+	GitHubPR       string
+	SummaryJSON    string
+	Top            int
+	PrintCountOnly bool
+}
+
+// writeConfig writes cfg to w as a json document, without the Checker's
+// options which can't be encoded, such as Patch and Debug.
+func writeConfig(w io.Writer, cfg config) error {
+	b, err := json.MarshalIndent(cfg, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bradleyfalzon/revgrep"
+)
+
+func TestRunPrintConfig(t *testing.T) {
+	var stdout, stderr strings.Builder
+	args := []string{"-print-config", "-d", "-format", "json", "-tool", "vet", "-vcs", "hg", "-linter-success-codes", "1",
+		"-fail-on", "none", "-input-format", "json", "-summary-json", "summary.json", "-top", "3", "-print-count-only", "HEAD~2"}
+	if exit := run(args, strings.NewReader(""), &stdout, &stderr); exit != 0 {
+		t.Fatalf("unexpected exit status %d: %s", exit, stderr.String())
+	}
+
+	var cfg config
+	if err := json.Unmarshal([]byte(stdout.String()), &cfg); err != nil {
+		t.Fatalf("could not decode config: %v\n%s", err, stdout.String())
+	}
+	want := config{
+		Checker: revgrep.Checker{
+			RevisionFrom:       "HEAD~2",
+			Tool:               "vet",
+			Format:             "json",
+			VCSOrder:           []string{"hg"},
+			LinterSuccessCodes: []int{1},
+		},
+		FailOn:         "none",
+		InputFormat:    "json",
+		SummaryJSON:    "summary.json",
+		Top:            3,
+		PrintCountOnly: true,
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("unexpected config:\nhave: %+v\nwant: %+v", cfg, want)
+	}
+
+	// defaults
+	stdout.Reset()
+	if exit := run([]string{"-print-config"}, strings.NewReader(""), &stdout, &stderr); exit != 0 {
+		t.Fatalf("unexpected exit status %d: %s", exit, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), `"Format": "text"`) {
+		t.Errorf("expected default format in config:\n%s", stdout.String())
+	}
+
+	// -diff and -github-pr aren't read
+	stdout.Reset()
+	args = []string{"-print-config", "-diff", "does-not-exist.patch", "-github-pr", "invalid"}
+	if exit := run(args, strings.NewReader(""), &stdout, &stderr); exit != 0 {
+		t.Fatalf("unexpected exit status %d: %s", exit, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), `"Diff": "does-not-exist.patch"`) || !strings.Contains(stdout.String(), `"GitHubPR": "invalid"`) {
+		t.Errorf("expected -diff and -github-pr in config:\n%s", stdout.String())
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/bradleyfalzon/revgrep"
+)
+
+// filterJSON decodes a json object of issues, as written by the json format,
+// from r, and writes those on changed lines to w in checker's format.
+func filterJSON(checker revgrep.Checker, r io.Reader, w io.Writer) ([]revgrep.Issue, error) {
+	if checker.Format == "annotated-diff" {
+		return nil, errors.New("the annotated-diff format can't be written for json input")
+	}
+
+	var input struct {
+		Issues []revgrep.Issue `json:"issues"`
+	}
+	if err := json.NewDecoder(r).Decode(&input); err != nil && err != io.EOF {
+		return nil, err
+	}
+	issues, err := checker.FilterIssues(input.Issues)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := revgrep.Render(checker.Format, issues, revgrep.RenderOptions{
+		IncludeRevisionMetadata: checker.IncludeRevisionMetadata,
+		Delimiter:               checker.Delimiter,
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = w.Write(out)
+	return issues, err
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunInputFormatJSON(t *testing.T) {
+	defer gitRepo(t)()
+
+	input := `{"issues": [
+		{"file": "main.go", "lineNo": 3, "colNo": 5, "issue": "main.go:3:5: first", "message": "first", "severity": "error"},
+		{"file": "main.go", "lineNo": 1, "message": "unchanged"},
+		{"file": "main.go", "lineNo": 3, "message": "second"}
+	]}`
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "main.go:3:5: first\nmain.go:3:0: second\n"},
+		{[]string{"-format", "json"}, `{"issues":[{"file":"main.go","lineNo":3,"colNo":5,"hunkPos":4,"issue":"main.go:3:5: first","message":"first","severity":"error"},{"file":"main.go","lineNo":3,"colNo":0,"hunkPos":4,"issue":"main.go:3:0: second","message":"second"}]}` + "\n"},
+	}
+
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+		args := append([]string{"-input-format", "json"}, test.args...)
+		if exit := run(args, strings.NewReader(input), &stdout, &stderr); exit != 1 {
+			t.Errorf("%v: unexpected exit status: have %d want 1", test.args, exit)
+		}
+		if have := stderr.String(); have != test.want {
+			t.Errorf("%v: unexpected output:\nhave: %q\nwant: %q", test.args, have, test.want)
+		}
+	}
+}
@@ -1,47 +1,258 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bradleyfalzon/revgrep"
+	"github.com/bradleyfalzon/revgrep/forge"
 )
 
 func main() {
-	flag.Usage = func() {
-		fmt.Println("Usage: revgrep [options] [from-rev] [to-rev]")
-		fmt.Println()
-		fmt.Println("from-rev filters issues to lines changed since (and including) this revision")
-		fmt.Println("  to-rev filters issues to lines changed since (and including) this revision, requires <from-rev>")
-		fmt.Println()
-		fmt.Println("If no revisions are given, and there are unstaged changes or untracked files, only those changes are shown")
-		fmt.Println("If no revisions are given, and there are no unstaged changes or untracked files, only changes in HEAD~ are shown")
-		fmt.Println("If from-rev is given and to-rev is not, only changes between from-rev and HEAD are shown.")
-		fmt.Println()
-		flag.PrintDefaults()
-	}
-
-	debug := flag.Bool("d", false, "Show debug output")
-	regexp := flag.String("regexp", "", "Regexp to match path, line number, optional column number, and message")
-	flag.Parse()
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs revgrep with the command line arguments args, excluding the
+// program name, and returns the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("revgrep", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stdout, "Usage: revgrep [options] [from-rev] [to-rev]")
+		fmt.Fprintln(stdout)
+		fmt.Fprintln(stdout, "from-rev filters issues to lines changed since (and including) this revision")
+		fmt.Fprintln(stdout, "  to-rev filters issues to lines changed since (and including) this revision, requires <from-rev>")
+		fmt.Fprintln(stdout)
+		fmt.Fprintln(stdout, "If no revisions are given, and there are unstaged changes or untracked files, only those changes are shown")
+		fmt.Fprintln(stdout, "If no revisions are given, and there are no unstaged changes or untracked files, only changes in HEAD~ are shown")
+		fmt.Fprintln(stdout, "If from-rev is given and to-rev is not, only changes between from-rev and HEAD are shown.")
+		fmt.Fprintln(stdout)
+		flags.PrintDefaults()
+	}
+
+	debug := flags.Bool("d", false, "Show debug output")
+	regexp := flags.String("regexp", "", "Regexp to match path, line number, optional column number, and message")
+	tool := flags.String("tool", "", "Name of built-in pattern to match the tool's output: default, golangci-lint, vet, dot-column or byte-offset")
+	byteOffsets := flags.Bool("byte-offsets", false, "Read the line number matched by -regexp or -tool as a byte offset in the file, such as with -tool byte-offset")
+	detect := flags.Bool("detect", false, "Detect the built-in pattern to match the tool's output")
+	vcs := flags.String("vcs", "", "Comma separated VCSs to detect, in order of precedence (default \"git,hg\")")
+	readOnlyGit := flags.Bool("read-only-git", false, "Read the patch with git plumbing commands which don't write to or lock the index, so they don't contend with other git commands")
+	lastCommit := flags.Bool("last-commit", false, "Only show issues on lines changed in the last commit of the range from-rev to to-rev")
+	failOn := flags.String("fail-on", "any", "Issues which cause an exit status of 1: any or none, where issues are only warnings")
+	strictNewFiles := flags.Bool("strict-new-files", false, "Issues in new files always cause an exit status of 1, regardless of -fail-on")
+	format := flags.String("format", "text", "Output format: text, json, tap, compact, markdown, markdown-details, vscode or annotated-diff")
+	patchOrder := flags.Bool("patch-order", false, "Order issues as their lines appear in the patch, rather than as they were read")
+	revisions := flags.Bool("revisions", false, "Include the from and to revision SHAs in json output")
+	diff := flags.String("diff", "", "Read the patch from this file, instead of from the VCS, where ~ and $VAR are expanded")
+	githubPR := flags.String("github-pr", "", "Read the patch of a GitHub pull request, owner/repo#number, authenticated with $GITHUB_TOKEN")
+	watchFiles := flags.Bool("watch", false, "Run -cmd and show its issues whenever files in the current directory change, until interrupted")
+	command := flags.String("cmd", "", "Shell command to run the linter in -watch mode, instead of reading its output from stdin")
+	successCodes := flags.String("linter-success-codes", "", "Comma separated exit statuses, besides 0, of -cmd which mean it ran successfully, such as 1 if it exits with 1 when reporting issues, any other is an error (default any)")
+	top := flags.Int("top", 0, "Print the N most common messages of issues on changed lines, with their counts, to stdout")
+	sinceDate := flags.String("since-date", "", "Only show issues on lines committed on or after this date, YYYY-MM-DD")
+	untilDate := flags.String("until-date", "", "Only show issues on lines committed on or before this date, YYYY-MM-DD")
+	delimiter := flags.String("delimiter", "", "Write issues in the text format as file, line, column and message separated by this, where \\t is a tab")
+	inputFormat := flags.String("input-format", "text", "Format of the issues read from stdin: text, parsed with -regexp or -tool, or json, as written by -format json")
+	summaryJSON := flags.String("summary-json", "", "Write a json summary of the run, with the numbers of files and lines changed and issues found, to this file, where ~ and $VAR are expanded")
+	printTargets := flags.Bool("print-targets", false, "Print the changed .go files, one per line, such as to run a linter on only those files, and exit")
+	printConfig := flags.Bool("print-config", false, "Print the options resolved from the flags and defaults as json, and exit")
+	countOnly := flags.Bool("print-count-only", false, "Only print the number of issues on changed lines to stdout, as a bare integer")
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return 0
+	} else if err != nil {
+		return 2
+	}
 
 	checker := revgrep.Checker{
-		RevisionFrom: flag.Arg(0),
-		RevisionTo:   flag.Arg(1),
-		Regexp:       *regexp,
+		RevisionFrom:            flags.Arg(0),
+		RevisionTo:              flags.Arg(1),
+		Regexp:                  *regexp,
+		Tool:                    *tool,
+		AutoDetectFormat:        *detect,
+		ByteOffsets:             *byteOffsets,
+		OnlyLastCommit:          *lastCommit,
+		ReadOnlyGit:             *readOnlyGit,
+		Format:                  *format,
+		IncludeRevisionMetadata: *revisions,
+		SortByPatchOrder:        *patchOrder,
+		StrictNewFiles:          *strictNewFiles,
+		Delimiter:               strings.Replace(*delimiter, `\t`, "\t", -1),
+	}
+
+	if *failOn != "any" && *failOn != "none" {
+		fmt.Fprintf(stderr, "unknown -fail-on value: %q\n", *failOn)
+		return 1
+	}
+
+	if *inputFormat != "text" && *inputFormat != "json" {
+		fmt.Fprintf(stderr, "unknown -input-format value: %q\n", *inputFormat)
+		return 1
+	}
+
+	if *sinceDate != "" {
+		date, err := time.Parse("2006-01-02", *sinceDate)
+		if err != nil {
+			fmt.Fprintf(stderr, "invalid -since-date: %s\n", err)
+			return 1
+		}
+		checker.SinceDate = date
+	}
+	if *untilDate != "" {
+		date, err := time.Parse("2006-01-02", *untilDate)
+		if err != nil {
+			fmt.Fprintf(stderr, "invalid -until-date: %s\n", err)
+			return 1
+		}
+		// include the entire day
+		checker.UntilDate = date.AddDate(0, 0, 1)
+	}
+
+	if *successCodes != "" {
+		checker.LinterSuccessCodes = []int{}
+		for _, code := range strings.Split(*successCodes, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(code))
+			if err != nil {
+				fmt.Fprintf(stderr, "invalid -linter-success-codes: %s\n", err)
+				return 1
+			}
+			checker.LinterSuccessCodes = append(checker.LinterSuccessCodes, n)
+		}
+	}
+
+	if *vcs != "" {
+		checker.VCSOrder = strings.Split(*vcs, ",")
+	}
+
+	// before -diff and -github-pr, which open files and make requests, and
+	// aren't part of the config
+	if *printConfig {
+		cfg := config{
+			Checker:        checker,
+			FailOn:         *failOn,
+			InputFormat:    *inputFormat,
+			Diff:           *diff,
+			GitHubPR:       *githubPR,
+			SummaryJSON:    *summaryJSON,
+			Top:            *top,
+			PrintCountOnly: *countOnly,
+		}
+		if err := writeConfig(stdout, cfg); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	if *diff != "" && *githubPR != "" {
+		fmt.Fprintln(stderr, "-diff and -github-pr can't both be set")
+		return 1
+	}
+	if *diff != "" {
+		path, err := expandPath(*diff)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "could not open -diff: %s\n", err)
+			return 1
+		}
+		defer f.Close()
+		checker.Patch = f
+	}
+
+	if *githubPR != "" {
+		owner, repo, number, err := forge.ParseGitHubPR(*githubPR)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		checker.Patch, err = forge.GitHubPRDiff(context.Background(), owner, repo, number, os.Getenv("GITHUB_TOKEN"))
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
 	}
 
 	if *debug {
-		checker.Debug = os.Stdout
+		checker.Debug = stdout
+	}
+
+	if *printTargets {
+		files, err := checker.ChangedFiles()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		for _, file := range files {
+			if strings.HasSuffix(file, ".go") {
+				fmt.Fprintln(stdout, file)
+			}
+		}
+		return 0
 	}
 
-	issues, err := checker.Check(os.Stdin, os.Stderr)
+	if *watchFiles {
+		if *command == "" {
+			fmt.Fprintln(stderr, "-watch requires -cmd")
+			return 1
+		}
+		if err := runWatch(checker, *command, stderr, nil); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	if *summaryJSON != "" {
+		path, err := expandPath(*summaryJSON)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		*summaryJSON = path
+		checker.Summary = &revgrep.Summary{}
+	}
+
+	output := stderr
+	if *countOnly {
+		output = ioutil.Discard
+	}
+	var (
+		issues []revgrep.Issue
+		err    error
+	)
+	if *inputFormat == "json" {
+		issues, err = filterJSON(checker, stdin, output)
+	} else {
+		issues, err = checker.Check(stdin, output)
+	}
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if *summaryJSON != "" {
+		if err := writeSummary(*summaryJSON, checker.Summary); err != nil {
+			fmt.Fprintf(stderr, "could not write summary: %s\n", err)
+			return 1
+		}
+	}
+	if *countOnly {
+		fmt.Fprintln(stdout, len(issues))
+	}
+	if *top > 0 {
+		writeTop(stdout, issues, *top)
 	}
-	if len(issues) > 0 {
-		os.Exit(1)
+	if checker.ShouldFail(issues, *failOn == "none") {
+		return 1
 	}
+	return 0
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitRepo creates a git repository in a temporary directory, with main.go
+// committed and then changed on line 3, and changes the working directory to
+// it, returning a function to change back and remove it.
+func gitRepo(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "revgrep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+
+	git := func(args ...string) {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			cleanup()
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	write := func(content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(content), 0644); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+	}
+	git("init")
+	git("config", "user.name", "testdata")
+	git("config", "user.email", "testdata@example.com")
+	write("package main\n\nfunc main() {}\n")
+	git("add", ".")
+	git("commit", "-m", "Initial commit")
+	write("package main\n\nfunc main() { changed() }\n")
+	return cleanup
+}
+
+func TestRunPrintCountOnly(t *testing.T) {
+	defer gitRepo(t)()
+
+	tests := []struct {
+		input string
+		want  string
+		exit  int
+	}{
+		{"main.go:3: first\nmain.go:3:5: second\nmain.go:1: unchanged\n", "2\n", 1},
+		{"main.go:1: unchanged\n", "0\n", 0},
+	}
+
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+		exit := run([]string{"-print-count-only"}, strings.NewReader(test.input), &stdout, &stderr)
+		if exit != test.exit {
+			t.Errorf("%q: unexpected exit status: have %d want %d", test.input, exit, test.exit)
+		}
+		if have := stdout.String(); have != test.want {
+			t.Errorf("%q: unexpected stdout: have %q want %q", test.input, have, test.want)
+		}
+		if stderr.Len() != 0 {
+			t.Errorf("%q: unexpected stderr: %q", test.input, stderr.String())
+		}
+	}
+}
+
+func TestRunPrintTargets(t *testing.T) {
+	defer gitRepo(t)()
+	for file, content := range map[string]string{"new.go": "package main\n", "notes.txt": "notes\n"} {
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout, stderr strings.Builder
+	if exit := run([]string{"-print-targets"}, strings.NewReader(""), &stdout, &stderr); exit != 0 {
+		t.Fatalf("unexpected exit status %d: %s", exit, stderr.String())
+	}
+	if have, want := stdout.String(), "main.go\nnew.go\n"; have != want {
+		t.Errorf("unexpected targets:\nhave: %q\nwant: %q", have, want)
+	}
+
+	// only files changed in the last commit of the range
+	for _, args := range [][]string{{"add", "new.go"}, {"commit", "-m", "New"}, {"add", "main.go"}, {"commit", "-m", "Changed"}} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	stdout.Reset()
+	if exit := run([]string{"-print-targets", "-last-commit", "HEAD~2"}, strings.NewReader(""), &stdout, &stderr); exit != 0 {
+		t.Fatalf("unexpected exit status %d: %s", exit, stderr.String())
+	}
+	if have, want := stdout.String(), "main.go\n"; have != want {
+		t.Errorf("unexpected targets with -last-commit:\nhave: %q\nwant: %q", have, want)
+	}
+}
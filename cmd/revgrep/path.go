@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// expandPath returns path with a leading ~ or ~user replaced by the home
+// directory of the current or named user, and $VAR or ${VAR} replaced by the
+// environment variable's value, or an empty string if it isn't set. An error
+// is returned if the home directory can't be found, such as if $HOME isn't
+// set.
+func expandPath(path string) (string, error) {
+	if strings.HasPrefix(path, "~") {
+		name, rest := path[1:], ""
+		if i := strings.IndexByte(name, '/'); i >= 0 {
+			name, rest = name[:i], name[i:]
+		}
+		home, err := homeDir(name)
+		if err != nil {
+			return "", fmt.Errorf("could not expand %q: %s", path, err)
+		}
+		path = filepath.Join(home, rest)
+		if rest == "/" {
+			path += "/"
+		}
+	}
+	return os.ExpandEnv(path), nil
+}
+
+// homeDir returns the home directory of the user name, or the current user
+// if empty.
+func homeDir(name string) (string, error) {
+	if name == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			return "", fmt.Errorf("$HOME is not set")
+		}
+		return home, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return u.HomeDir, nil
+}
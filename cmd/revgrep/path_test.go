@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandPath(t *testing.T) {
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", "/home/revgrep")
+	os.Setenv("REVGREP_DIFFS", "/tmp/diffs")
+	defer os.Unsetenv("REVGREP_DIFFS")
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"", ""},
+		{"pr.patch", "pr.patch"},
+		{"~", "/home/revgrep"},
+		{"~/", "/home/revgrep/"},
+		{"~/diffs/pr.patch", "/home/revgrep/diffs/pr.patch"},
+		{"a/~/pr.patch", "a/~/pr.patch"},
+		{"$REVGREP_DIFFS/pr.patch", "/tmp/diffs/pr.patch"},
+		{"${REVGREP_DIFFS}/pr.patch", "/tmp/diffs/pr.patch"},
+		{"~/pr$REVGREP_UNSET.patch", "/home/revgrep/pr.patch"},
+	}
+	for _, test := range tests {
+		have, err := expandPath(test.path)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.path, err)
+		}
+		if have != test.want {
+			t.Errorf("%q: have %q want %q", test.path, have, test.want)
+		}
+	}
+
+	if u, err := user.Current(); err == nil {
+		if have, err := expandPath("~" + u.Username + "/pr.patch"); err != nil || have != u.HomeDir+"/pr.patch" {
+			t.Errorf("unexpected expansion of ~%s: %q, %v", u.Username, have, err)
+		}
+	}
+	if _, err := expandPath("~revgrep-unknown-user/pr.patch"); err == nil {
+		t.Error("expected error for unknown user")
+	}
+
+	os.Unsetenv("HOME")
+	if _, err := expandPath("~/pr.patch"); err == nil {
+		t.Error("expected error without $HOME")
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "revgrep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	patch := "--- a/file.go\n+++ b/file.go\n@@ -1,1 +1,2 @@\n func Line() {}\n+func NewLine() {}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "pr.patch"), []byte(patch), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", dir)
+
+	var stdout, stderr bytes.Buffer
+	exit := run([]string{"-diff", "~/pr.patch"}, strings.NewReader("file.go:1: unchanged\nfile.go:2: changed\n"), &stdout, &stderr)
+	if exit != 1 {
+		t.Errorf("unexpected exit status: have %d want 1", exit)
+	}
+	if want := "file.go:2: changed\n"; stderr.String() != want {
+		t.Errorf("unexpected output: have %q want %q", stderr.String(), want)
+	}
+}
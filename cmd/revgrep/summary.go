@@ -0,0 +1,17 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/bradleyfalzon/revgrep"
+)
+
+// writeSummary writes summary as a json document to the file path.
+func writeSummary(path string, summary *revgrep.Summary) error {
+	b, err := json.MarshalIndent(summary, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/bradleyfalzon/revgrep"
+)
+
+func TestRunSummaryJSON(t *testing.T) {
+	defer gitRepo(t)()
+
+	// written after the repository is read, so it isn't an untracked file
+	const path = "summary.json"
+	var stdout, stderr strings.Builder
+	exit := run([]string{"-summary-json", path}, strings.NewReader("main.go:3: changed\nmain.go:1: unchanged\n"), &stdout, &stderr)
+	if exit != 1 {
+		t.Errorf("unexpected exit status: have %d want 1", exit)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary revgrep.Summary
+	if err := json.Unmarshal(b, &summary); err != nil {
+		t.Fatalf("could not decode summary: %v\n%s", err, b)
+	}
+	if summary.FilesChanged != 1 || summary.LinesChanged != 1 || summary.Issues != 1 || summary.VCS != "git" {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	if summary.Revisions == nil || summary.Revisions.From == "" || summary.Revisions.To != "" {
+		t.Errorf("unexpected revisions: %+v", summary.Revisions)
+	}
+}
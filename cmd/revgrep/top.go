@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/bradleyfalzon/revgrep"
+)
+
+// messageCount is the number of issues with a message.
+type messageCount struct {
+	message string
+	count   int
+}
+
+// topMessages returns the n most common messages in issues, most common
+// first, and ties ordered by message.
+func topMessages(issues []revgrep.Issue, n int) []messageCount {
+	var top []messageCount
+	for message, count := range revgrep.CountByMessage(issues) {
+		top = append(top, messageCount{message: message, count: count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].count != top[j].count {
+			return top[i].count > top[j].count
+		}
+		return top[i].message < top[j].message
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// writeTop writes the n most common messages in issues, with their counts,
+// to w.
+func writeTop(w io.Writer, issues []revgrep.Issue, n int) {
+	for _, top := range topMessages(issues, n) {
+		fmt.Fprintf(w, "%d\t%s\n", top.count, top.message)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bradleyfalzon/revgrep"
+)
+
+func TestWriteTop(t *testing.T) {
+	var issues []revgrep.Issue
+	for message, count := range map[string]int{"unused": 3, "shadowed": 1, "unchecked error": 2, "deprecated": 2} {
+		for i := 0; i < count; i++ {
+			issues = append(issues, revgrep.Issue{File: "main.go", LineNo: i + 1, Message: message})
+		}
+	}
+
+	var out bytes.Buffer
+	writeTop(&out, issues, 3)
+
+	want := "3\tunused\n2\tdeprecated\n2\tunchecked error\n"
+	if have := out.String(); have != want {
+		t.Errorf("unexpected output:\nhave: %q\nwant: %q", have, want)
+	}
+}
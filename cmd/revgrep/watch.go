@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bradleyfalzon/revgrep"
+)
+
+// watchInterval is how often files are checked for changes in -watch mode.
+const watchInterval = 500 * time.Millisecond
+
+// runWatch runs command, writing its issues on changed lines to w, then again
+// whenever a file within the current directory changes, until interrupted.
+// The patch is read once, from checker's Patch, such as by -github-pr, or
+// the VCS, and reused for each run. Watching stops when stop is closed.
+func runWatch(checker revgrep.Checker, command string, w io.Writer, stop <-chan struct{}) error {
+	checker, err := checker.WithPatch()
+	if err != nil {
+		return err
+	}
+	patch, err := ioutil.ReadAll(checker.Patch)
+	if err != nil {
+		return fmt.Errorf("could not read patch: %s", err)
+	}
+
+	run := func() {
+		c := checker
+		c.Patch = bytes.NewReader(patch)
+		issues, err := c.CheckCommand(exec.Command("sh", "-c", command), w)
+		if err != nil {
+			fmt.Fprintln(w, err)
+		}
+		fmt.Fprintf(w, "revgrep: %d issues, watching for changes\n", len(issues))
+	}
+	run()
+	watch(".", watchInterval, stop, run)
+	return nil
+}
+
+// watch calls run whenever a file within root is created, modified or
+// removed, checking every interval until stop is closed. Files are polled
+// rather than using OS notifications, so no dependencies are required.
+func watch(root string, interval time.Duration, stop <-chan struct{}, run func()) {
+	last := snapshot(root)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		current := snapshot(root)
+		if !sameSnapshot(last, current) {
+			run()
+			// files written by run, such as caches, don't trigger a re-run
+			current = snapshot(root)
+		}
+		last = current
+	}
+}
+
+// snapshot returns the modification time of each file within root, ignoring
+// hidden files and directories, such as .git.
+func snapshot(root string) map[string]time.Time {
+	files := make(map[string]time.Time)
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path != root && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			files[path] = info.ModTime()
+		}
+		return nil
+	})
+	return files
+}
+
+// sameSnapshot returns true if a and b contain the same files, with the same
+// modification times.
+func sameSnapshot(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, mtime := range a {
+		if other, ok := b[path]; !ok || !other.Equal(mtime) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradleyfalzon/revgrep"
+)
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "revgrep-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(file, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runs := make(chan struct{}, 10)
+	stop := make(chan struct{})
+	defer close(stop)
+	go watch(dir, 10*time.Millisecond, stop, func() { runs <- struct{}{} })
+
+	// allow the initial snapshot to be taken
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-runs:
+		t.Fatal("unexpected run without changes")
+	default:
+	}
+
+	// hidden files are ignored
+	if err := ioutil.WriteFile(filepath.Join(dir, ".hidden"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-runs:
+		t.Fatal("unexpected run after hidden file changed")
+	default:
+	}
+
+	mtime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(file, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-runs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected run after file changed")
+	}
+}
+
+func TestRunWatchStrictValidation(t *testing.T) {
+	defer gitRepo(t)()
+
+	// the revisions the patch was read from aren't ignored
+	checker := revgrep.Checker{RevisionFrom: "HEAD", StrictValidation: true}
+	stop := make(chan struct{})
+	close(stop)
+	var out strings.Builder
+	if err := runWatch(checker, "echo main.go:3:1: issue", &out, stop); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if have, want := out.String(), "main.go:3:1: issue\nrevgrep: 1 issues, watching for changes\n"; have != want {
+		t.Errorf("unexpected output:\nhave: %q\nwant: %q", have, want)
+	}
+}
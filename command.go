@@ -0,0 +1,43 @@
+package revgrep
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// CheckCommand runs the linter cmd, and checks its combined output, as Check
+// does, writing issues on changed lines to writer. If the linter exits with a
+// status other than 0 or one of LinterSuccessCodes, if set, its output isn't
+// checked and an error, including its output, is returned.
+func (c Checker) CheckCommand(cmd *exec.Cmd, writer io.Writer) ([]Issue, error) {
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil, fmt.Errorf("could not run linter: %s", err)
+		}
+		if code := exitErr.ExitCode(); !c.linterSucceeded(code) {
+			return nil, fmt.Errorf("linter exited with status %d: %s", code, bytes.TrimSpace(out.Bytes()))
+		}
+		c.debugf("linter exited with status %d", exitErr.ExitCode())
+	}
+	return c.Check(&out, writer)
+}
+
+// linterSucceeded returns true if a linter exiting with code ran
+// successfully, see LinterSuccessCodes.
+func (c Checker) linterSucceeded(code int) bool {
+	if c.LinterSuccessCodes == nil || code == 0 {
+		return true
+	}
+	for _, success := range c.LinterSuccessCodes {
+		if code == success {
+			return true
+		}
+	}
+	return false
+}
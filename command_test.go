@@ -0,0 +1,52 @@
+package revgrep
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"testing"
+)
+
+func TestCheckerCheckCommand(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,1 +1,2 @@
+ func Line() {}
++func NewLine() {}`)
+
+	tests := []struct {
+		successCodes []int
+		exit         string
+		want         int // issues, or -1 for an error
+	}{
+		{nil, "0", 1},
+		{nil, "1", 1},
+		{nil, "3", 1},
+		{[]int{1}, "0", 1},
+		{[]int{1}, "1", 1},
+		{[]int{1}, "3", -1},
+		{[]int{}, "1", -1},
+	}
+
+	for _, test := range tests {
+		checker := Checker{
+			Patch:              bytes.NewReader(diff),
+			LinterSuccessCodes: test.successCodes,
+		}
+		cmd := exec.Command("sh", "-c", "echo file.go:1:unchanged; echo file.go:2:changed >&2; exit "+test.exit)
+		issues, err := checker.CheckCommand(cmd, ioutil.Discard)
+		switch {
+		case test.want < 0 && err == nil:
+			t.Errorf("codes %v exit %s: expected error", test.successCodes, test.exit)
+		case test.want >= 0 && err != nil:
+			t.Errorf("codes %v exit %s: unexpected error: %v", test.successCodes, test.exit, err)
+		case test.want >= 0 && len(issues) != test.want:
+			t.Errorf("codes %v exit %s: unexpected issues: %#v", test.successCodes, test.exit, issues)
+		}
+	}
+
+	checker := Checker{Patch: bytes.NewReader(diff)}
+	if _, err := checker.CheckCommand(exec.Command("revgrep-missing-linter"), ioutil.Discard); err == nil {
+		t.Error("expected error running missing linter")
+	}
+}
@@ -0,0 +1,62 @@
+// Package forge reads patches from code forges, such as GitHub, to be used as
+// revgrep.Checker's Patch without a local checkout.
+package forge
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// githubAPI is the base URL of the GitHub API, overridden in tests.
+var githubAPI = "https://api.github.com"
+
+// GitHubPRDiff returns the diff of a GitHub pull request number in the
+// repository owner/repo. If token is not empty, it's used to authenticate,
+// which is required for private repositories.
+func GitHubPRDiff(ctx context.Context, owner, repo string, number int, token string) (io.Reader, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d", githubAPI, owner, repo, number)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/vnd.github.v3.diff")
+	if token != "" {
+		req.Header.Set("Authorization", "token "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch diff for %s/%s#%d: %s", owner, repo, number, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read diff for %s/%s#%d: %s", owner, repo, number, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch diff for %s/%s#%d: %s", owner, repo, number, resp.Status)
+	}
+	return bytes.NewReader(body), nil
+}
+
+// ParseGitHubPR parses a pull request in the form owner/repo#number.
+func ParseGitHubPR(pr string) (owner, repo string, number int, err error) {
+	hash := strings.LastIndex(pr, "#")
+	slash := strings.Index(pr, "/")
+	if hash < 0 || slash <= 0 || slash+1 >= hash {
+		return "", "", 0, fmt.Errorf("invalid pull request %q, expected owner/repo#number", pr)
+	}
+	number, err = strconv.Atoi(pr[hash+1:])
+	if err != nil || number <= 0 {
+		return "", "", 0, fmt.Errorf("invalid pull request number in %q", pr)
+	}
+	return pr[:slash], pr[slash+1 : hash], number, nil
+}
@@ -0,0 +1,77 @@
+package forge
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGitHubPRDiff(t *testing.T) {
+	recorded, err := ioutil.ReadFile("testdata/github-pr.diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/owner/repo/pulls/123" {
+			http.NotFound(w, r)
+			return
+		}
+		if accept := r.Header.Get("Accept"); accept != "application/vnd.github.v3.diff" {
+			t.Errorf("unexpected Accept header: %q", accept)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "token secret" {
+			t.Errorf("unexpected Authorization header: %q", auth)
+		}
+		w.Write(recorded)
+	}))
+	defer ts.Close()
+
+	defer func(api string) { githubAPI = api }(githubAPI)
+	githubAPI = ts.URL
+
+	diff, err := GitHubPRDiff(context.Background(), "owner", "repo", 123, "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	have, err := ioutil.ReadAll(diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(have) != string(recorded) {
+		t.Errorf("unexpected diff:\nhave: %s\nwant: %s", have, recorded)
+	}
+
+	if _, err := GitHubPRDiff(context.Background(), "owner", "repo", 404, "secret"); err == nil {
+		t.Error("expected error for missing pull request")
+	}
+}
+
+func TestParseGitHubPR(t *testing.T) {
+	tests := []struct {
+		pr     string
+		owner  string
+		repo   string
+		number int
+		err    bool
+	}{
+		{"owner/repo#123", "owner", "repo", 123, false},
+		{"owner/repo", "", "", 0, true},
+		{"owner#123", "", "", 0, true},
+		{"/repo#123", "", "", 0, true},
+		{"owner/#123", "", "", 0, true},
+		{"owner/repo#abc", "", "", 0, true},
+		{"owner/repo#0", "", "", 0, true},
+	}
+	for _, test := range tests {
+		owner, repo, number, err := ParseGitHubPR(test.pr)
+		if (err != nil) != test.err {
+			t.Errorf("%q: unexpected error: %v", test.pr, err)
+		}
+		if owner != test.owner || repo != test.repo || number != test.number {
+			t.Errorf("%q: have %q %q %d, want %q %q %d", test.pr, owner, repo, number, test.owner, test.repo, test.number)
+		}
+	}
+}
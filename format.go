@@ -0,0 +1,327 @@
+package revgrep
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RenderOptions are the options of formats rendered by Render.
+type RenderOptions struct {
+	// IncludeRevisionMetadata includes Revisions in the json format, see
+	// Checker.IncludeRevisionMetadata.
+	IncludeRevisionMetadata bool
+	// Revisions are the revisions the issues were filtered against, if
+	// known.
+	Revisions *Revisions
+	// Patch is the patch the issues were filtered against, used by the
+	// annotated-diff format. It's parsed as Checker parses a patch with its
+	// default options.
+	Patch []byte
+	// Delimiter separates the fields of each issue in the text format, see
+	// Checker.Delimiter.
+	Delimiter string
+
+	// changes are the positions changed in each file in Patch, if it has
+	// already been parsed, such as by Check with its options.
+	changes map[string][]pos
+	// lineSplit splits Patch into lines, see Checker.LineSplit.
+	lineSplit bufio.SplitFunc
+	// raw are the values captured by the regexp for each issue, by
+	// Issue.Issue, included in the json format, see Checker.IncludeRaw.
+	raw map[string]map[string]string
+}
+
+// formats maps format names to functions writing issues in the format, see
+// Render.
+var formats = map[string]func(w io.Writer, issues []Issue, opts RenderOptions) error{
+	"text": writeText,
+	"json": func(w io.Writer, issues []Issue, opts RenderOptions) error {
+		var revisions *Revisions
+		if opts.IncludeRevisionMetadata {
+			revisions = opts.Revisions
+		}
+		return writeJSON(w, issues, revisions, opts.raw)
+	},
+	"tap": func(w io.Writer, issues []Issue, opts RenderOptions) error {
+		_, err := io.WriteString(w, IssuesToTAP(issues))
+		return err
+	},
+	"compact": func(w io.Writer, issues []Issue, opts RenderOptions) error {
+		_, err := io.WriteString(w, IssuesToCompact(issues))
+		return err
+	},
+	"markdown": func(w io.Writer, issues []Issue, opts RenderOptions) error {
+		_, err := io.WriteString(w, IssuesToMarkdown(issues))
+		return err
+	},
+	"markdown-details": func(w io.Writer, issues []Issue, opts RenderOptions) error {
+		_, err := io.WriteString(w, IssuesToMarkdownDetails(issues))
+		return err
+	},
+	"vscode": func(w io.Writer, issues []Issue, opts RenderOptions) error {
+		_, err := io.WriteString(w, IssuesToVSCode(issues))
+		return err
+	},
+	"annotated-diff": func(w io.Writer, issues []Issue, opts RenderOptions) error {
+		return writeAnnotatedDiff(w, opts, issues)
+	},
+}
+
+// Render returns issues in the named format, one of the formats of
+// Checker.Format, which is "text" if empty. A valid document is returned
+// even if there are no issues.
+func Render(format string, issues []Issue, opts RenderOptions) ([]byte, error) {
+	if format == "" {
+		format = "text"
+	}
+	write, ok := formats[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format: %q", format)
+	}
+	if issues == nil {
+		issues = []Issue{}
+	}
+	var buf bytes.Buffer
+	if err := write(&buf, issues, opts); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeFormat writes issues to w in the structured format c.Format, see
+// Render. Patch is the patch read and changes the positions parsed from it,
+// only used by the annotated-diff format, and raw the values captured for
+// each issue, see IncludeRaw.
+func (c Checker) writeFormat(w io.Writer, issues []Issue, revisions *Revisions, patch []byte, changes map[string][]pos, raw map[string]map[string]string) error {
+	out, err := Render(c.Format, issues, RenderOptions{
+		IncludeRevisionMetadata: c.IncludeRevisionMetadata,
+		Revisions:               revisions,
+		Patch:                   patch,
+		Delimiter:               c.Delimiter,
+		changes:                 changes,
+		lineSplit:               c.LineSplit,
+		raw:                     raw,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// writeText writes each issue to w as it appeared from the tool, or as
+// delimited fields if opts.Delimiter is set.
+func writeText(w io.Writer, issues []Issue, opts RenderOptions) error {
+	bw := bufio.NewWriter(w)
+	for _, issue := range issues {
+		line := issue.Issue
+		if opts.Delimiter != "" {
+			line = delimitedIssue(issue, issue.File, opts.Delimiter)
+		}
+		fmt.Fprintln(bw, line)
+	}
+	return bw.Flush()
+}
+
+// writeJSON writes issues to w as a JSON object, along with the revisions,
+// if any, the issues were filtered against, see jsonIssues.
+func writeJSON(w io.Writer, issues []Issue, revisions *Revisions, raw map[string]map[string]string) error {
+	report := struct {
+		Revisions *Revisions  `json:"revisions,omitempty"`
+		Issues    interface{} `json:"issues"`
+	}{revisions, jsonIssues(issues, raw)}
+	return json.NewEncoder(w).Encode(report)
+}
+
+// jsonIssues returns issues to encode as JSON, with the values captured for
+// each, by Issue.Issue, in raw, if not nil, see Checker.IncludeRaw.
+func jsonIssues(issues []Issue, raw map[string]map[string]string) interface{} {
+	if raw == nil {
+		return issues
+	}
+	type rawIssue struct {
+		Issue
+		Raw map[string]string `json:"raw,omitempty"`
+	}
+	withRaw := make([]rawIssue, len(issues))
+	for i, issue := range issues {
+		withRaw[i] = rawIssue{issue, raw[issue.Issue]}
+	}
+	return withRaw
+}
+
+// delimitedIssue returns issue, in file, as its line, column and message,
+// separated by delimiter, see Checker.Delimiter.
+func delimitedIssue(issue Issue, file, delimiter string) string {
+	return strings.Join([]string{file, strconv.Itoa(issue.LineNo), strconv.Itoa(issue.ColNo), issue.Message}, delimiter)
+}
+
+// IssuesToTAP returns issues in the Test Anything Protocol, with a plan of
+// one test point per issue, each of which has failed.
+//
+// See also: https://testanything.org/tap-specification.html
+func IssuesToTAP(issues []Issue) string {
+	var tap bytes.Buffer
+	fmt.Fprintf(&tap, "1..%d\n", len(issues))
+	for i, issue := range issues {
+		fmt.Fprintf(&tap, "not ok %d - %s:%d %s\n", i+1, issue.File, issue.LineNo, issue.Message)
+	}
+	return tap.String()
+}
+
+// IssuesToVSCode returns a line for each issue in the canonical form matched
+// by problem matchers in VS Code tasks, "file:line:col: severity: message",
+// without "severity: " if the issue's severity isn't known. Issues without a
+// column are reported at column 1.
+func IssuesToVSCode(issues []Issue) string {
+	var vscode bytes.Buffer
+	for _, issue := range issues {
+		col := issue.ColNo
+		if col < 1 {
+			col = 1
+		}
+		fmt.Fprintf(&vscode, "%s:%d:%d: ", issue.File, issue.LineNo, col)
+		if issue.Severity != "" {
+			fmt.Fprintf(&vscode, "%s: ", issue.Severity)
+		}
+		fmt.Fprintln(&vscode, issue.Message)
+	}
+	return vscode.String()
+}
+
+// IssuesToCompact returns a line for each file with issues, in the order
+// files first appear, with the number of issues and their line numbers in
+// ascending order, such as "file.go: 3 issues (lines 3, 6, 10)". Files which
+// are new have " in new file" after the number of issues.
+func IssuesToCompact(issues []Issue) string {
+	var compact bytes.Buffer
+	for _, group := range GroupByFile(issues) {
+		var (
+			lines   []int
+			seen    = make(map[int]bool)
+			newFile bool
+		)
+		for _, issue := range group.Issues {
+			if !seen[issue.LineNo] {
+				seen[issue.LineNo] = true
+				lines = append(lines, issue.LineNo)
+			}
+			newFile = newFile || issue.NewFile
+		}
+		sort.Ints(lines)
+
+		count, label := fmt.Sprintf("%d issues", len(group.Issues)), "lines"
+		if len(group.Issues) == 1 {
+			count = "1 issue"
+		}
+		if len(lines) == 1 {
+			label = "line"
+		}
+		if newFile {
+			count += " in new file"
+		}
+		nums := make([]string, len(lines))
+		for i, line := range lines {
+			nums[i] = strconv.Itoa(line)
+		}
+		fmt.Fprintf(&compact, "%s: %s (%s %s)\n", group.File, count, label, strings.Join(nums, ", "))
+	}
+	return compact.String()
+}
+
+// noIssuesMarkdown is written by the Markdown formats if there are no
+// issues.
+const noIssuesMarkdown = "No new issues \U0001F389\n"
+
+// IssuesToMarkdown returns issues as a Markdown table of their file, line
+// number and message.
+func IssuesToMarkdown(issues []Issue) string {
+	if len(issues) == 0 {
+		return noIssuesMarkdown
+	}
+	var md bytes.Buffer
+	md.WriteString("| File | Line | Message |\n| --- | --- | --- |\n")
+	for _, issue := range issues {
+		fmt.Fprintf(&md, "| %s | %d | %s |\n", markdownCell(issue.File), issue.LineNo, markdownCell(issue.Message))
+	}
+	return md.String()
+}
+
+// IssuesToMarkdownDetails returns issues as Markdown, in a collapsible
+// <details> section summarising the number of issues, with a heading and
+// table of line numbers and messages for each file, in the order files first
+// appear in issues. Collapsible sections are supported by GitHub, such as in
+// pull request comments.
+func IssuesToMarkdownDetails(issues []Issue) string {
+	if len(issues) == 0 {
+		return noIssuesMarkdown
+	}
+	var md bytes.Buffer
+	summary := fmt.Sprintf("%d issues", len(issues))
+	if len(issues) == 1 {
+		summary = "1 issue"
+	}
+	fmt.Fprintf(&md, "<details>\n<summary>%s</summary>\n", summary)
+	for _, group := range GroupByFile(issues) {
+		fmt.Fprintf(&md, "\n### %s\n\n| Line | Message |\n| --- | --- |\n", markdownCell(group.File))
+		for _, issue := range group.Issues {
+			fmt.Fprintf(&md, "| %d | %s |\n", issue.LineNo, markdownCell(issue.Message))
+		}
+	}
+	md.WriteString("\n</details>\n")
+	return md.String()
+}
+
+// markdownCell escapes s for a cell of a Markdown table.
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
+
+// writeAnnotatedDiff writes opts.Patch to w, with a "// revgrep: <message>"
+// line after each added line with issues. Lines are found from the positions
+// parsed from the patch, so the patch is written as it was read.
+func writeAnnotatedDiff(w io.Writer, opts RenderOptions, issues []Issue) error {
+	changes := opts.changes
+	if changes == nil {
+		var err error
+		c := Checker{Patch: bytes.NewReader(opts.Patch), Format: "annotated-diff", LineSplit: opts.lineSplit}
+		if changes, err = c.patchChanges(); err != nil {
+			return err
+		}
+	}
+
+	messages := make(map[int][]string) // by line number within the patch
+	for _, issue := range issues {
+		var patchLine int
+		for _, p := range changes[issue.File] {
+			if p.lineNo == issue.LineNo && !p.deleted {
+				patchLine = p.patchLine
+			}
+		}
+		if patchLine > 0 {
+			messages[patchLine] = append(messages[patchLine], issue.Message)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	scanner := bufio.NewScanner(bytes.NewReader(opts.Patch))
+	if opts.lineSplit != nil {
+		scanner.Split(opts.lineSplit)
+	}
+	for patchLine := 1; scanner.Scan(); patchLine++ {
+		fmt.Fprintln(bw, scanner.Text())
+		for _, message := range messages[patchLine] {
+			fmt.Fprintf(bw, "// revgrep: %s\n", message)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,479 @@
+package revgrep
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckFormatJSON(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,1 +1,1 @@
+-func Line() {}
++func NewLine() {}`)
+
+	checker := Checker{
+		Patch:  bytes.NewReader(diff),
+		Format: "json",
+	}
+
+	var out bytes.Buffer
+	_, err := checker.Check(strings.NewReader("file.go:1:5:issue\nfile.go:2:other"), &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var have struct {
+		Issues []Issue
+	}
+	if err := json.Unmarshal(out.Bytes(), &have); err != nil {
+		t.Fatalf("could not decode output %q: %v", out.String(), err)
+	}
+	want := []Issue{{File: "file.go", LineNo: 1, ColNo: 5, HunkPos: 2, Issue: "file.go:1:5:issue", Message: "issue"}}
+	if !reflect.DeepEqual(have.Issues, want) {
+		t.Errorf("unexpected issues:\nhave: %#v\nwant: %#v", have, want)
+	}
+}
+
+func TestCheckFormatNoIssues(t *testing.T) {
+	tests := []struct {
+		format    string
+		revisions bool
+		want      string
+	}{
+		{"text", false, ""},
+		{"json", false, "{\"issues\":[]}\n"},
+		{"json", true, "{\"issues\":[]}\n"},
+	}
+
+	for _, test := range tests {
+		checker := Checker{
+			Patch:                   bytes.NewReader(nil),
+			Format:                  test.format,
+			IncludeRevisionMetadata: test.revisions,
+		}
+
+		var out bytes.Buffer
+		_, err := checker.Check(strings.NewReader("file.go:1:issue\n"), &out)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.format, err)
+		}
+		if have := out.String(); have != test.want {
+			t.Errorf("%v: unexpected output:\nhave: %q\nwant: %q", test.format, have, test.want)
+		}
+	}
+}
+
+func TestCheckFormatNoRepository(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("could not get working dir: %s", err)
+	}
+	defer teardown(t, wd)
+	if err := os.Chdir("/"); err != nil {
+		t.Fatalf("could not chdir: %v", err)
+	}
+
+	checker := Checker{Format: "json"}
+
+	var out bytes.Buffer
+	_, err = checker.Check(strings.NewReader("file.go:1:issue\n"), &out)
+	if err == nil {
+		t.Error("expected error without repository")
+	}
+
+	var have struct {
+		Issues []Issue
+	}
+	if err := json.Unmarshal(out.Bytes(), &have); err != nil {
+		t.Fatalf("could not decode output %q: %v", out.String(), err)
+	}
+	want := []Issue{{File: "file.go", LineNo: 1, Issue: "file.go:1:issue", Message: "issue"}}
+	if !reflect.DeepEqual(have.Issues, want) {
+		t.Errorf("unexpected issues:\nhave: %#v\nwant: %#v", have, want)
+	}
+}
+
+func TestCheckRevisionMetadata(t *testing.T) {
+	prevwd, sample := setup(t, "10-committed", "")
+	defer teardown(t, prevwd)
+
+	checker := Checker{
+		RevisionFrom:            "HEAD~1",
+		RevisionTo:              "HEAD~0",
+		Format:                  "json",
+		IncludeRevisionMetadata: true,
+	}
+
+	var out bytes.Buffer
+	_, err := checker.Check(bytes.NewReader(sample), &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var have struct {
+		Revisions Revisions
+	}
+	if err := json.Unmarshal(out.Bytes(), &have); err != nil {
+		t.Fatalf("could not decode output %q: %v", out.String(), err)
+	}
+
+	var want Revisions
+	for _, rev := range []struct {
+		name string
+		sha  *string
+	}{{"HEAD~1", &want.From}, {"HEAD", &want.To}} {
+		out, err := exec.Command("git", "rev-parse", rev.name).Output()
+		if err != nil {
+			t.Fatalf("could not rev-parse %v: %v", rev.name, err)
+		}
+		*rev.sha = strings.TrimSpace(string(out))
+	}
+	if have.Revisions != want {
+		t.Errorf("unexpected revisions:\nhave: %#v\nwant: %#v", have.Revisions, want)
+	}
+}
+
+func TestIssuesToTAP(t *testing.T) {
+	issues := []Issue{
+		{File: "file.go", LineNo: 1, Message: "issue"},
+		{File: "other.go", LineNo: 12, Message: "other issue"},
+	}
+	want := "1..2\nnot ok 1 - file.go:1 issue\nnot ok 2 - other.go:12 other issue\n"
+	if have := IssuesToTAP(issues); have != want {
+		t.Errorf("unexpected TAP:\nhave: %q\nwant: %q", have, want)
+	}
+	if have, want := IssuesToTAP(nil), "1..0\n"; have != want {
+		t.Errorf("unexpected TAP for no issues: have %q want %q", have, want)
+	}
+}
+
+func TestCheckFormatTAP(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,1 +1,1 @@
+-func Line() {}
++func NewLine() {}`)
+
+	checker := Checker{
+		Patch:  bytes.NewReader(diff),
+		Format: "tap",
+	}
+
+	var out bytes.Buffer
+	_, err := checker.Check(strings.NewReader("file.go:1:5:issue\nfile.go:2:other"), &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if have, want := out.String(), "1..1\nnot ok 1 - file.go:1 issue\n"; have != want {
+		t.Errorf("unexpected output:\nhave: %q\nwant: %q", have, want)
+	}
+}
+
+func TestCheckFormatAnnotatedDiff(t *testing.T) {
+	diff := `--- a/file.go
++++ b/file.go
+@@ -1,3 +1,4 @@
+ func Line() {}
+-func OldLine() {}
++func NewLine() {}
++func OtherLine() {}
+ func LastLine() {}
+--- a/other.go
++++ b/other.go
+@@ -10,1 +10,1 @@
+-func Line() {}
++func NewLine() {}
+`
+
+	checker := Checker{
+		Patch:  strings.NewReader(diff),
+		Format: "annotated-diff",
+	}
+
+	var out bytes.Buffer
+	input := "file.go:3:first\nfile.go:3:second\nfile.go:4:unchanged\nother.go:10:third\n"
+	if _, err := checker.Check(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `--- a/file.go
++++ b/file.go
+@@ -1,3 +1,4 @@
+ func Line() {}
+-func OldLine() {}
++func NewLine() {}
++func OtherLine() {}
+// revgrep: first
+// revgrep: second
+ func LastLine() {}
+--- a/other.go
++++ b/other.go
+@@ -10,1 +10,1 @@
+-func Line() {}
++func NewLine() {}
+// revgrep: third
+`
+	if have := out.String(); have != want {
+		t.Errorf("unexpected output:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestCheckFormatAnnotatedDiffDialects(t *testing.T) {
+	tests := []struct {
+		name    string
+		checker Checker
+		diff    string
+		input   string
+		want    string
+	}{
+		{
+			name:    "file header pattern",
+			checker: Checker{FileHeaderPattern: `^Index: (.*)$`},
+			diff:    "Index: main.go\n--- main.go\t(revision 1)\n+++ main.go\t(working copy)\n@@ -1,1 +1,2 @@\n package main\n+func main() {}\n",
+			input:   "main.go:2: issue\n",
+			want:    "Index: main.go\n--- main.go\t(revision 1)\n+++ main.go\t(working copy)\n@@ -1,1 +1,2 @@\n package main\n+func main() {}\n// revgrep: issue\n",
+		},
+		{
+			name:    "markers",
+			checker: Checker{AddedMarker: "> ", RemovedMarker: "< "},
+			diff:    "--- a/file.go\n+++ b/file.go\n@@ -1,2 +1,2 @@\n func Line() {}\n< func OldLine() {}\n> func NewLine() {}\n",
+			input:   "file.go:2: issue\n",
+			want:    "--- a/file.go\n+++ b/file.go\n@@ -1,2 +1,2 @@\n func Line() {}\n< func OldLine() {}\n> func NewLine() {}\n// revgrep: issue\n",
+		},
+		{
+			name:  "combined",
+			diff:  "--- a/file.go\n+++ b/file.go\n@@@ -1,1 -1,1 +1,2 @@@\n  func Line() {}\n++func NewLine() {}\n",
+			input: "file.go:2: issue\n",
+			want:  "--- a/file.go\n+++ b/file.go\n@@@ -1,1 -1,1 +1,2 @@@\n  func Line() {}\n++func NewLine() {}\n// revgrep: issue\n",
+		},
+		{
+			name:  "renamed and deleted",
+			diff:  "rename from old.go\nrename to new.go\n--- a/old.go\n+++ b/new.go\n@@ -1,1 +1,2 @@\n func Line() {}\n+func NewLine() {}\n--- a/gone.go\n+++ /dev/null\n@@ -1,1 +0,0 @@\n-func Line() {}\n",
+			input: "new.go:2: issue\ndev/null:1: deleted\n",
+			want:  "rename from old.go\nrename to new.go\n--- a/old.go\n+++ b/new.go\n@@ -1,1 +1,2 @@\n func Line() {}\n+func NewLine() {}\n// revgrep: issue\n--- a/gone.go\n+++ /dev/null\n@@ -1,1 +0,0 @@\n-func Line() {}\n",
+		},
+	}
+	for _, test := range tests {
+		checker := test.checker
+		checker.Patch = strings.NewReader(test.diff)
+		checker.Format = "annotated-diff"
+
+		var out bytes.Buffer
+		if _, err := checker.Check(strings.NewReader(test.input), &out); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if have := out.String(); have != test.want {
+			t.Errorf("%s: unexpected output:\nhave:\n%s\nwant:\n%s", test.name, have, test.want)
+		}
+	}
+}
+
+func TestCheckDelimiter(t *testing.T) {
+	diff := []byte(`--- a/C:\src\main.go
++++ b/C:\src\main.go
+@@ -1,1 +1,2 @@
+-func Line() {}
++func NewLine() {}
++func OtherLine() {}`)
+
+	checker := Checker{
+		Patch:     bytes.NewReader(diff),
+		Delimiter: "\t",
+	}
+
+	var out bytes.Buffer
+	input := "C:\\src\\main.go:1:5: first\nC:\\src\\main.go:2: second: with colon\n"
+	if _, err := checker.Check(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "C:\\src\\main.go\t1\t5\tfirst\nC:\\src\\main.go\t2\t0\tsecond: with colon\n"
+	if have := out.String(); have != want {
+		t.Errorf("unexpected output:\nhave: %q\nwant: %q", have, want)
+	}
+}
+
+func TestCheckIncludeRaw(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,1 +1,1 @@
+-func Line() {}
++func NewLine() {}`)
+
+	tests := []struct {
+		regexp string
+		want   map[string]string
+	}{
+		{"", map[string]string{"1": "file.go", "2": "1", "3": "5", "4": "issue"}},
+		{`(?P<file>.*?\.go):(?P<line>[0-9]+):([0-9]+):(?P<message>.*)`, map[string]string{"file": "file.go", "line": "1", "3": "5", "message": "issue"}},
+	}
+
+	for _, test := range tests {
+		checker := Checker{
+			Patch:      bytes.NewReader(diff),
+			Regexp:     test.regexp,
+			Format:     "json",
+			IncludeRaw: true,
+		}
+
+		var out bytes.Buffer
+		issues, err := checker.Check(strings.NewReader("file.go:1:5:issue\n"), &out)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var report struct {
+			Issues []struct {
+				Issue
+				Raw map[string]string `json:"raw"`
+			}
+		}
+		if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+			t.Fatalf("could not decode output %q: %v", out.String(), err)
+		}
+		have := report.Issues
+		if len(have) != 1 || !reflect.DeepEqual(have[0].Raw, test.want) {
+			t.Errorf("%q: unexpected raw groups in %s, want %v", test.regexp, out.String(), test.want)
+		}
+		if len(issues) != 1 || len(have) != 1 || have[0].Issue != issues[0] {
+			t.Errorf("%q: unexpected issues in %s, want %v", test.regexp, out.String(), issues)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	issues := []Issue{
+		{File: "file.go", LineNo: 1, ColNo: 5, HunkPos: 2, Issue: "file.go:1:5: issue", Message: "issue"},
+		{File: "other.go", LineNo: 2, HunkPos: 3, Issue: "other.go:2: other", Message: "other"},
+	}
+
+	tests := []struct {
+		format string
+		opts   RenderOptions
+		want   string
+	}{
+		{"", RenderOptions{}, "file.go:1:5: issue\nother.go:2: other\n"},
+		{"text", RenderOptions{Delimiter: "\t"}, "file.go\t1\t5\tissue\nother.go\t2\t0\tother\n"},
+		{"json", RenderOptions{}, `{"issues":[{"file":"file.go","lineNo":1,"colNo":5,"hunkPos":2,"issue":"file.go:1:5: issue","message":"issue"},{"file":"other.go","lineNo":2,"colNo":0,"hunkPos":3,"issue":"other.go:2: other","message":"other"}]}` + "\n"},
+		{"tap", RenderOptions{}, "1..2\nnot ok 1 - file.go:1 issue\nnot ok 2 - other.go:2 other\n"},
+		{"vscode", RenderOptions{}, "file.go:1:5: issue\nother.go:2:1: other\n"},
+		{"annotated-diff", RenderOptions{Patch: []byte("+++ b/other.go\n@@ -1,1 +1,2 @@\n line\n+added\n")}, "+++ b/other.go\n@@ -1,1 +1,2 @@\n line\n+added\n// revgrep: other\n"},
+	}
+
+	for _, test := range tests {
+		have, err := Render(test.format, issues, test.opts)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.format, err)
+		}
+		if string(have) != test.want {
+			t.Errorf("%q: unexpected output:\nhave: %q\nwant: %q", test.format, have, test.want)
+		}
+	}
+
+	// the same shape, with the revisions only if included
+	revisions := &Revisions{From: "a", To: "b"}
+	if have, err := Render("json", nil, RenderOptions{Revisions: revisions}); err != nil || string(have) != "{\"issues\":[]}\n" {
+		t.Errorf("unexpected json report %q or error: %v", have, err)
+	}
+	if have, err := Render("json", nil, RenderOptions{IncludeRevisionMetadata: true, Revisions: revisions}); err != nil || string(have) != "{\"revisions\":{\"from\":\"a\",\"to\":\"b\"},\"issues\":[]}\n" {
+		t.Errorf("unexpected json report %q or error: %v", have, err)
+	}
+	if _, err := Render("unknown", issues, RenderOptions{}); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestIssuesToMarkdown(t *testing.T) {
+	issues := []Issue{
+		{File: "file.go", LineNo: 1, Message: "issue"},
+		{File: "other.go", LineNo: 2, Message: "a | b"},
+	}
+	want := "| File | Line | Message |\n| --- | --- | --- |\n| file.go | 1 | issue |\n| other.go | 2 | a \\| b |\n"
+	if have := IssuesToMarkdown(issues); have != want {
+		t.Errorf("unexpected markdown:\nhave: %q\nwant: %q", have, want)
+	}
+	if have, want := IssuesToMarkdown(nil), "No new issues \U0001F389\n"; have != want {
+		t.Errorf("unexpected markdown without issues: have %q want %q", have, want)
+	}
+}
+
+func TestIssuesToMarkdownDetails(t *testing.T) {
+	issues := []Issue{
+		{File: "file.go", LineNo: 1, Message: "first"},
+		{File: "other.go", LineNo: 2, Message: "second"},
+		{File: "file.go", LineNo: 5, Message: "third"},
+	}
+	want := `<details>
+<summary>3 issues</summary>
+
+### file.go
+
+| Line | Message |
+| --- | --- |
+| 1 | first |
+| 5 | third |
+
+### other.go
+
+| Line | Message |
+| --- | --- |
+| 2 | second |
+
+</details>
+`
+	if have := IssuesToMarkdownDetails(issues); have != want {
+		t.Errorf("unexpected markdown:\nhave: %q\nwant: %q", have, want)
+	}
+	if have := IssuesToMarkdownDetails(issues[:1]); !strings.Contains(have, "<summary>1 issue</summary>") {
+		t.Errorf("unexpected summary of 1 issue:\n%s", have)
+	}
+
+	have, err := Render("markdown-details", nil, RenderOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "No new issues \U0001F389\n"; string(have) != want {
+		t.Errorf("unexpected markdown without issues: have %q want %q", have, want)
+	}
+}
+
+func TestIssuesToVSCode(t *testing.T) {
+	issues := []Issue{
+		{File: "file.go", LineNo: 1, ColNo: 5, Severity: "error", Message: "issue"},
+		{File: "dir/other.go", LineNo: 12, Severity: "warning", Message: "other: issue"},
+		{File: "file.go", LineNo: 3, ColNo: 2, Message: "no severity"},
+	}
+	want := "file.go:1:5: error: issue\ndir/other.go:12:1: warning: other: issue\nfile.go:3:2: no severity\n"
+	if have := IssuesToVSCode(issues); have != want {
+		t.Errorf("unexpected vscode output:\nhave: %q\nwant: %q", have, want)
+	}
+	if have := IssuesToVSCode(nil); have != "" {
+		t.Errorf("unexpected vscode output without issues: %q", have)
+	}
+}
+
+func TestIssuesToCompact(t *testing.T) {
+	issues := []Issue{
+		{File: "file.go", LineNo: 10, Message: "first"},
+		{File: "other.go", LineNo: 2, Message: "second"},
+		{File: "file.go", LineNo: 3, Message: "third"},
+		{File: "file.go", LineNo: 6, Message: "fourth"},
+		{File: "file.go", LineNo: 6, Message: "fifth"},
+		{File: "new.go", LineNo: 1, Message: "sixth", NewFile: true},
+		{File: "new.go", LineNo: 4, Message: "seventh", NewFile: true},
+	}
+	want := "file.go: 4 issues (lines 3, 6, 10)\nother.go: 1 issue (line 2)\nnew.go: 2 issues in new file (lines 1, 4)\n"
+	if have := IssuesToCompact(issues); have != want {
+		t.Errorf("unexpected compact output:\nhave: %q\nwant: %q", have, want)
+	}
+	if have := IssuesToCompact(nil); have != "" {
+		t.Errorf("unexpected compact output without issues: %q", have)
+	}
+}
@@ -0,0 +1,122 @@
+package revgrep
+
+import "fmt"
+
+// DiffIssueSets returns the issues in before which aren't in after, fixed,
+// and the issues in after which aren't in before, introduced, in the order
+// they appear.
+//
+// Issues are equal if they have the same Key, if both have one, see
+// Checker.StableKeys, else the same File and Message. Line numbers aren't
+// compared, so issues which only moved, such as due to lines added above
+// them, are neither fixed nor introduced. Equal issues are counted, so if an
+// issue appears twice before and once after, one is fixed.
+func DiffIssueSets(before, after []Issue) (fixed, introduced []Issue) {
+	return subtractIssues(before, after), subtractIssues(after, before)
+}
+
+// subtractIssues returns the issues in a which aren't in b, see
+// DiffIssueSets.
+func subtractIssues(a, b []Issue) []Issue {
+	remaining := make(map[issueKey]int)
+	for _, issue := range b {
+		remaining[keyOf(issue)]++
+	}
+	var diff []Issue
+	for _, issue := range a {
+		key := keyOf(issue)
+		if remaining[key] > 0 {
+			remaining[key]--
+			continue
+		}
+		diff = append(diff, issue)
+	}
+	return diff
+}
+
+// issueKey identifies equal issues, see DiffIssueSets.
+type issueKey struct {
+	key, file, message string
+}
+
+// keyOf returns the issueKey of issue.
+func keyOf(issue Issue) issueKey {
+	if issue.Key != "" {
+		return issueKey{key: issue.Key}
+	}
+	return issueKey{file: issue.File, message: issue.Message}
+}
+
+// CountByMessage returns the number of issues with each message.
+func CountByMessage(issues []Issue) map[string]int {
+	counts := make(map[string]int)
+	for _, issue := range issues {
+		counts[issue.Message]++
+	}
+	return counts
+}
+
+// FileIssues are the issues in a file, see GroupByFile.
+type FileIssues struct {
+	File   string
+	Issues []Issue
+}
+
+// GroupByFile returns issues grouped by their file, in the order each file
+// first appears in issues, and the issues in each file in the order they
+// appear.
+func GroupByFile(issues []Issue) []FileIssues {
+	var (
+		groups []FileIssues
+		index  = make(map[string]int)
+	)
+	for _, issue := range issues {
+		i, ok := index[issue.File]
+		if !ok {
+			i = len(groups)
+			index[issue.File] = i
+			groups = append(groups, FileIssues{File: issue.File})
+		}
+		groups[i].Issues = append(groups[i].Issues, issue)
+	}
+	return groups
+}
+
+// FilterIssues returns the issues on changed lines, as Check does for issues
+// parsed from a tool's output, such as issues decoded from revgrep's json
+// format, or another tool's structured output. Each issue's File is made
+// relative to the patch as in Check, and the options parsing the tool's
+// output, such as Regexp, Tool and ByteOffsets, and those writing issues,
+// are ignored.
+//
+// The returned issues have their HunkPos, NewFile, Key and Symbol set, and
+// Issue.Issue, if empty, set to "file:line:col: message".
+func (c Checker) FilterIssues(issues []Issue) ([]Issue, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if len(issues) == 0 && c.Summary == nil && !c.RequireLinterSawAllFiles {
+		// as in Check, there's no point reading the patch
+		return nil, nil
+	}
+	revisions, vcs, err := c.readPatch()
+	if err != nil {
+		return nil, err
+	}
+	if c.Debug != nil {
+		// the patch is parsed concurrently, serialise debug output
+		c.Debug = &lockedWriter{w: c.Debug}
+	}
+	m, err := c.newMatcher(vcs, revisions)
+	defer m.changes.wait()
+
+	for _, issue := range issues {
+		issue.File = m.relPath(issue.File)
+		issue.Severity = c.normalizeSeverity(issue.Severity)
+		if issue.Issue == "" {
+			issue.Issue = fmt.Sprintf("%s:%d:%d: %s", issue.File, issue.LineNo, issue.ColNo, issue.Message)
+		}
+		m.match(issue)
+	}
+	return m.finish(err)
+}
@@ -0,0 +1,163 @@
+package revgrep
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDiffIssueSets(t *testing.T) {
+	before := []Issue{
+		{File: "a.go", LineNo: 1, Message: "unused"},
+		{File: "a.go", LineNo: 5, Message: "shadowed"},
+		{File: "a.go", LineNo: 9, Message: "shadowed"},
+		{File: "b.go", LineNo: 2, Message: "unused"},
+		{File: "c.go", LineNo: 3, Message: "renamed", Key: "k1"},
+	}
+	after := []Issue{
+		{File: "a.go", LineNo: 3, Message: "unused"}, // moved
+		{File: "a.go", LineNo: 7, Message: "shadowed"},
+		{File: "b.go", LineNo: 2, Message: "unchecked error"},
+		{File: "c.go", LineNo: 3, Message: "renamed var", Key: "k1"},
+		{File: "d.go", LineNo: 1, Message: "unused"},
+	}
+
+	fixed, introduced := DiffIssueSets(before, after)
+
+	wantFixed := []Issue{
+		{File: "a.go", LineNo: 9, Message: "shadowed"},
+		{File: "b.go", LineNo: 2, Message: "unused"},
+	}
+	if !reflect.DeepEqual(fixed, wantFixed) {
+		t.Errorf("unexpected fixed:\nhave: %#v\nwant: %#v", fixed, wantFixed)
+	}
+	wantIntroduced := []Issue{
+		{File: "b.go", LineNo: 2, Message: "unchecked error"},
+		{File: "d.go", LineNo: 1, Message: "unused"},
+	}
+	if !reflect.DeepEqual(introduced, wantIntroduced) {
+		t.Errorf("unexpected introduced:\nhave: %#v\nwant: %#v", introduced, wantIntroduced)
+	}
+
+	if fixed, introduced := DiffIssueSets(before, before); fixed != nil || introduced != nil {
+		t.Errorf("expected no differences, got fixed %v introduced %v", fixed, introduced)
+	}
+}
+
+func TestCountByMessage(t *testing.T) {
+	issues := []Issue{
+		{File: "a.go", LineNo: 1, Message: "unused"},
+		{File: "a.go", LineNo: 2, Message: "shadowed"},
+		{File: "b.go", LineNo: 1, Message: "unused"},
+	}
+	want := map[string]int{"unused": 2, "shadowed": 1}
+	if have := CountByMessage(issues); !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected counts: have %v want %v", have, want)
+	}
+}
+
+func TestCheckerFilterIssues(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,1 +1,2 @@
+-func Line() {}
++func NewLine() {}
++func OtherLine() {}`)
+
+	var sunk []Issue
+	checker := Checker{
+		Patch:     bytes.NewReader(diff),
+		NewFiles:  []string{"new.go"},
+		IssueSink: func(issue Issue) { sunk = append(sunk, issue) },
+		LineMatch: func(content string, issue Issue) bool {
+			return issue.Message != "rejected\tby line match"
+		},
+	}
+	issues, err := checker.FilterIssues([]Issue{
+		{File: "file.go", LineNo: 1, ColNo: 2, Issue: "file.go:1:2: unused (lint)", Message: "unused"},
+		{File: "file.go", LineNo: 5, Message: "unchanged"},
+		{File: "./file.go", LineNo: 2, Message: "rejected\tby line match"},
+		{File: "file.go", LineNo: 2, Message: "multi\nline", Severity: "warning"},
+		{File: "new.go", LineNo: 9, Message: "new"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []Issue{
+		{File: "file.go", LineNo: 1, ColNo: 2, HunkPos: 2, Issue: "file.go:1:2: unused (lint)", Message: "unused"},
+		{File: "file.go", LineNo: 2, HunkPos: 3, Issue: "file.go:2:0: multi\nline", Message: "multi\nline", Severity: "warning"},
+		{File: "new.go", LineNo: 9, HunkPos: 9, Issue: "new.go:9:0: new", Message: "new", NewFile: true},
+	}
+	if !reflect.DeepEqual(issues, want) {
+		t.Errorf("unexpected issues:\nhave: %#v\nwant: %#v", issues, want)
+	}
+	if !reflect.DeepEqual(sunk, want) {
+		t.Errorf("unexpected sunk issues:\nhave: %#v\nwant: %#v", sunk, want)
+	}
+}
+
+func TestCheckerFilterIssuesEmptyFile(t *testing.T) {
+	// the deleted file has no name, like issues without a file
+	diff := []byte(`--- a/deleted.go
++++ /dev/null
+@@ -1,1 +0,0 @@
+-package main`)
+
+	checker := Checker{Patch: bytes.NewReader(diff)}
+	issues, err := checker.FilterIssues([]Issue{{LineNo: 1, Message: "no file"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if issues != nil {
+		t.Errorf("unexpected issues: %#v", issues)
+	}
+}
+
+func TestGroupByFile(t *testing.T) {
+	issues := []Issue{
+		{File: "b.go", LineNo: 1},
+		{File: "a.go", LineNo: 2},
+		{File: "b.go", LineNo: 3},
+	}
+	want := []FileIssues{
+		{File: "b.go", Issues: []Issue{{File: "b.go", LineNo: 1}, {File: "b.go", LineNo: 3}}},
+		{File: "a.go", Issues: []Issue{{File: "a.go", LineNo: 2}}},
+	}
+	if have := GroupByFile(issues); !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected groups:\nhave: %#v\nwant: %#v", have, want)
+	}
+}
+
+func TestCheckerFilterIssuesIgnoresParsing(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,1 +1,2 @@
+-func Line() {}
++func NewLine() {}
++func OtherLine() {}`)
+
+	checker := Checker{
+		Patch:            bytes.NewReader(diff),
+		NewFiles:         []string{"tab\tfile.go"},
+		ByteOffsets:      true,
+		TolerantNumbers:  true,
+		MaxInputLines:    1,
+		SplitMultiOnLine: true,
+	}
+	issues, err := checker.FilterIssues([]Issue{
+		{File: "file.go", LineNo: 2, Message: "first; second"},
+		{File: "tab\tfile.go", LineNo: 1, Message: "new"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []Issue{
+		{File: "file.go", LineNo: 2, HunkPos: 3, Issue: "file.go:2:0: first; second", Message: "first; second"},
+		{File: "tab\tfile.go", LineNo: 1, HunkPos: 1, Issue: "tab\tfile.go:1:0: new", Message: "new", NewFile: true},
+	}
+	if !reflect.DeepEqual(issues, want) {
+		t.Errorf("unexpected issues:\nhave: %#v\nwant: %#v", issues, want)
+	}
+}
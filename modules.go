@@ -0,0 +1,56 @@
+package revgrep
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// moduleRoots returns the directories within root containing a go.mod file,
+// the deepest first, ignoring hidden, vendor and testdata directories below
+// root.
+func moduleRoots(root string) ([]string, error) {
+	var roots []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path != root {
+			name := info.Name()
+			if strings.HasPrefix(name, ".") || name == "vendor" || name == "testdata" {
+				return filepath.SkipDir
+			}
+		}
+		if !info.IsDir() && info.Name() == "go.mod" {
+			roots = append(roots, filepath.Dir(path))
+		}
+		return nil
+	})
+	sort.SliceStable(roots, func(i, j int) bool {
+		return strings.Count(roots[i], string(filepath.Separator)) > strings.Count(roots[j], string(filepath.Separator))
+	})
+	return roots, err
+}
+
+// modulePath returns path, an issue's file relative to absPath or to the
+// root of the module it's in, relative to absPath. If path doesn't exist
+// relative to absPath, it's made relative to the first of roots, as returned
+// by moduleRoots, containing it, else path is returned unchanged.
+func modulePath(roots []string, absPath, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	if _, err := os.Stat(filepath.Join(absPath, path)); err == nil {
+		return path
+	}
+	for _, root := range roots {
+		if _, err := os.Stat(filepath.Join(root, path)); err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(absPath, filepath.Join(root, path)); err == nil {
+			return rel
+		}
+	}
+	return path
+}
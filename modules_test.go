@@ -0,0 +1,74 @@
+package revgrep
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckerModuleAware(t *testing.T) {
+	root, err := filepath.Abs(filepath.Join("testdata", "modules"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := []byte(`--- a/main.go
++++ b/main.go
+@@ -3,1 +3,1 @@
+-func old() {}
++func main() {}
+--- a/api/handler.go
++++ b/api/handler.go
+@@ -3,1 +3,1 @@
+-func Old() {}
++func Handler() {}
+--- a/tools/lint/lint.go
++++ b/tools/lint/lint.go
+@@ -3,1 +3,1 @@
+-func Old() {}
++func Run() {}`)
+
+	// main.go exists relative to the root, and the others are relative to
+	// their module
+	input := "main.go:3: root\nhandler.go:3: api\nlint.go:3: lint\nmissing.go:3: missing\n"
+
+	tests := []struct {
+		moduleAware bool
+		want        []string
+	}{
+		{false, []string{"main.go"}},
+		{true, []string{"main.go", "api/handler.go", "tools/lint/lint.go"}},
+	}
+
+	for _, test := range tests {
+		checker := Checker{
+			Patch:       bytes.NewReader(diff),
+			AbsPath:     root,
+			ModuleAware: test.moduleAware,
+		}
+		issues, err := checker.Check(strings.NewReader(input), ioutil.Discard)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var have []string
+		for _, issue := range issues {
+			have = append(have, issue.File)
+		}
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("moduleAware %v: unexpected files: have %q want %q", test.moduleAware, have, test.want)
+		}
+	}
+
+	roots, err := moduleRoots(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(root, "tools", "lint"), filepath.Join(root, "api"), root}
+	if !reflect.DeepEqual(roots, want) {
+		t.Errorf("unexpected module roots:\nhave: %q\nwant: %q", roots, want)
+	}
+}
@@ -6,59 +6,411 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Checker provides APIs to filter static analysis tools to specific commits,
 // such as showing only issues since last commit.
 type Checker struct {
 	// Patch file (unified) to read to detect lines being changed, if nil revgrep
-	// will attempt to detect the VCS and generate an appropriate patch. Auto
-	// detection will search for uncommitted changes first, if none found, will
-	// generate a patch from last committed change. File paths within patches
-	// must be relative to current working directory.
-	Patch io.Reader
+	// will attempt to detect the VCS, see VCSOrder, and generate an appropriate
+	// patch. Auto detection will search for uncommitted changes first, if none
+	// found, will generate a patch from last committed change. File paths
+	// within patches must be relative to current working directory. Combined
+	// diffs, such as from git diff --cc for a merge, are also supported, where
+	// lines added relative to any parent are changed.
+	Patch io.Reader `json:"-"`
 	// NewFiles is a list of file names (with absolute paths) where the entire
 	// contents of the file is new.
 	NewFiles []string
+	// ChangedFilesList, if set and Patch is nil, is a list of file names,
+	// relative to the current working directory or absolute, see AbsPath,
+	// whose entire contents are changed, such as from a build system, instead
+	// of reading a patch from a VCS. Unlike NewFiles, issues in them don't
+	// have NewFile set, as they may not be new.
+	ChangedFilesList []string
+	// FileHeaderPattern, if set, is a regexp matching the line starting each
+	// file in the patch, whose first capture group is the file name, for
+	// patches other than git's, such as `^Index: (.*)$` for Subversion. Lines
+	// between a match and the file's first @@ are ignored, such as --- and
+	// +++. If not set, each file starts at its +++ line.
+	FileHeaderPattern string
+	// AddedMarker and RemovedMarker prefix lines added and removed in the
+	// patch, for diffs from tools using markers other than unified diff's
+	// + and -, which are used if not set, such as > for added lines. This is
+	// only a first step to support other diff formats, such as context
+	// diffs, as hunks still require unified diff's @@ headers and a file
+	// header, see FileHeaderPattern. Ignored for combined diffs.
+	AddedMarker   string
+	RemovedMarker string
 	// Debug sets the debug writer for additional output.
-	Debug io.Writer
+	Debug io.Writer `json:"-"`
+	// ReadOnlyGit reads patches from git with ReadOnlyGitPatch, rather than
+	// GitPatch, and runs every other git command, such as to resolve
+	// revisions or blame lines, as ReadOnlyGitPatch does, so git doesn't
+	// write to the index, or contend for its lock with other git commands,
+	// such as on a busy CI runner.
+	ReadOnlyGit bool
+	// VCSOrder is the names of the VCSs, registered with RegisterVCS, to
+	// detect a repository with, in order of precedence, such as when multiple
+	// VCSs are colocated. If nil, DefaultVCSOrder is used. Options which refer
+	// to git, such as OnlyLastCommit, only apply to git repositories.
+	VCSOrder []string
+	// CacheDir, if set, is the directory patches between RevisionFrom and
+	// RevisionTo, when both are set, are cached in for subsequent runs. The
+	// patch is cached, rather than the lines changed, as they depend on other
+	// options. Patches are keyed by their revisions' SHAs, resolved with git
+	// rev-parse, so they're invalidated when either revision changes. Only
+	// git repositories are cached.
+	CacheDir string
 	// RevisionFrom check revision starting at, leave blank for auto detection
 	// ignored if patch is set.
 	RevisionFrom string
 	// RevisionTo checks revision finishing at, leave blank for auto detection
 	// ignored if patch is set.
 	RevisionTo string
+	// StrictValidation returns an error from Validate, and so Check, for
+	// options which are likely a mistake, rather than writing a warning to
+	// Debug.
+	StrictValidation bool
 	// Regexp to match path, line number, optional column number, and message.
+	// See CompiledRegexp for which capture groups are used.
 	Regexp string
+	// Tool is the name of a built-in pattern to match the tool's output with,
+	// such as "golangci-lint" or "vet", or one added by RegisterToolPattern,
+	// ignored if Regexp is set.
+	Tool string
+	// AutoDetectFormat detects which built-in pattern to match the tool's
+	// output with, using the pattern matching the most of the first 10
+	// non-empty lines. If no pattern, or more than one, matched the most
+	// lines, DefaultTool is used. Ignored if Regexp or Tool is set.
+	AutoDetectFormat bool
+	// PreserveMessageWhitespace keeps the leading whitespace of each issue's
+	// message, such as indented sub-messages, only removing the single space
+	// separating it from the file and line number. Ignored if Regexp is set,
+	// which controls its own message group. The built-in patterns support it,
+	// but a pattern added by RegisterToolPattern must match the message with
+	// `:?\s*(.*)`, else Check returns an error.
+	PreserveMessageWhitespace bool
+	// SplitMultiOnLine splits each line of input containing multiple issues,
+	// separated by MultiOnLineSeparator, into an issue for each, as written
+	// by tools which report related issues on a single line. Lines are only
+	// split if every part, with surrounding whitespace removed, matches the
+	// regexp, so a separator within a message doesn't split it.
+	SplitMultiOnLine bool
+	// MultiOnLineSeparator separates issues on a line, see SplitMultiOnLine.
+	// If empty, DefaultMultiOnLineSeparator is used.
+	MultiOnLineSeparator string
+	// MaxInputLines, if positive, is the most lines of input read, such as
+	// to protect against a runaway tool. If the input has more lines, the
+	// rest aren't read, and the issues matched so far are returned with an
+	// error. Each issue split by SplitMultiOnLine counts as a line.
+	MaxInputLines int
+	// SeverityMap maps each tool's severities, captured by the regexp, to a
+	// common set, such as "blocker" to "error", so issues from different
+	// tools can be compared. Severities are matched exactly, or else in lower
+	// case, and are unchanged if not in the map.
+	SeverityMap map[string]string
+	// StrictColumnParse ignores issues whose column number was captured but
+	// couldn't be parsed, such as when Regexp's column group captured part of
+	// the message, instead of setting their ColNo to 0.
+	StrictColumnParse bool
+	// TolerantNumbers parses line and column numbers containing underscores
+	// or commas as thousands separators, such as 1_234 or 1,234, which are
+	// otherwise ignored as malformed. The line and column groups of Tool's
+	// pattern, or the default pattern, also match the separators, but
+	// Regexp must capture them itself. A pattern added by RegisterToolPattern
+	// must match the numbers with `([0-9]+)`, else Check returns an error.
+	TolerantNumbers bool
+	// ByteOffsets treats the line number captured by Regexp, such as with Tool
+	// "byte-offset", as a byte offset from the start of the file, counting
+	// from 0, as reported by some tools. Each offset is converted to a line
+	// number, and a column number if none was captured, by reading the file
+	// relative to AbsPath, so the file must exist as the tool saw it. Issues
+	// whose offset is beyond the end of the file, or whose file can't be
+	// read, are ignored.
+	ByteOffsets bool
 	// AbsPath is used to make an absolute path of an issue's filename to be
 	// relative in order to match patch file. If not set, current working
 	// directory is used.
 	AbsPath string
+	// URLDecodePaths decodes percent-encoded characters in issues' file
+	// names, such as "my%20file.go" from tools which write paths as URLs, to
+	// match the literal file names in the patch. File names which aren't
+	// valid percent-encoding are used as is.
+	URLDecodePaths bool
+	// PreferGitPaths makes each issue's filename relative to the root of its
+	// git repository, as in a patch from git, with git ls-files --full-name,
+	// rather than relative to AbsPath with filepath.Rel. This is correct even
+	// if AbsPath and the issue's path are different paths to the same
+	// directory, such as via symlinks or bind mounts. Relative filenames are
+	// relative to AbsPath. If git doesn't know the file, such as when it's
+	// ignored or not in a git repository, AbsPath is used. Git is run once
+	// for each file with issues.
+	PreferGitPaths bool
+	// ModuleAware matches issues whose file names are relative to the root of
+	// their Go module, rather than AbsPath, such as from a linter run in each
+	// module of a repository with multiple modules. Modules are found by
+	// walking AbsPath for go.mod files, ignoring hidden, vendor and testdata
+	// directories, once per Check. If an issue's file doesn't exist relative
+	// to AbsPath, it's made relative to AbsPath from the most deeply nested
+	// module containing it.
+	ModuleAware bool
+	// LineSplit is the split function used to read lines from Patch, if nil
+	// bufio.ScanLines is used. See ScanAnyLines to also split on a lone \r.
+	LineSplit bufio.SplitFunc `json:"-"`
+	// WholeFileThreshold, if greater than 0, treats an entire file as changed
+	// when the ratio of its changed lines to its total lines, as read from
+	// the file relative to AbsPath, exceeds the threshold. For example, 0.5
+	// reports all issues in files where more than half the lines changed.
+	WholeFileThreshold float64
+	// StatementAware matches issues on any line of a Go statement spanning
+	// multiple lines, such as a call with an argument on each line, if any
+	// of its lines changed, as a change to one line may cause an issue to be
+	// reported on another. Issues on unchanged lines have the HunkPos of the
+	// statement's first changed line. Compound statements, such as if and
+	// for, and the bodies of function literals, don't extend the lines
+	// matched. Only .go files are supported, and each changed .go file is
+	// read, relative to AbsPath, and parsed once per Check, which may be
+	// slow for large patches.
+	StatementAware bool
+	// Format is the output format written by Check, either "text" (default)
+	// to write each issue as it appeared from the tool, "json" to write a
+	// JSON object with an "issues" array and, if IncludeRevisionMetadata is
+	// set, the "revisions", "tap" to write issues in the Test Anything
+	// Protocol, see IssuesToTAP, "compact" to write a line summarising the
+	// issues in each file, see IssuesToCompact, "markdown" to write a
+	// Markdown table of issues, "markdown-details" to write issues grouped by
+	// file in a collapsible section, such as for a pull request comment, see
+	// IssuesToMarkdownDetails, "vscode" to write issues as matched by VS Code
+	// problem matchers, see IssuesToVSCode, or "annotated-diff" to write the
+	// patch with a "// revgrep: <message>" line after each added line with
+	// issues, once all input has been read.
+	Format string
+	// IncludeRevisionMetadata includes the revisions the patch was generated
+	// from in the json format, see GitRevisions. Ignored if Patch is set.
+	IncludeRevisionMetadata bool
+	// MaxChangedFiles, if greater than 0, limits the number of files whose
+	// changed lines are tracked. If more files are changed, all changed files
+	// are treated as new files, matching all of their issues, and a warning is
+	// written to Debug.
+	MaxChangedFiles int
+	// OnlyLastCommit, when RevisionFrom is set, only matches lines changed in
+	// the range which were also changed in its last commit, RevisionTo, or HEAD
+	// if not set. Uncommitted changes and untracked files are ignored. For
+	// example, given commits A, B and C, "A..C" would only match lines added
+	// in C. Ignored if Patch is set.
+	OnlyLastCommit bool
+	// SquashAware, when RevisionFrom is set, compares against the merge base
+	// of RevisionFrom and RevisionTo, or HEAD if not set, as with git diff
+	// A...B, instead of RevisionFrom itself. Branches which have been squash
+	// merged into RevisionFrom, such as a default branch on GitHub, are then
+	// re-checked against where they branched from, rather than a squash
+	// commit already containing their changes. If there's no merge base,
+	// such as in a shallow clone, RevisionFrom is used. Changes made by
+	// merging RevisionFrom into the branch after it branched are also
+	// matched. Ignored if Patch is set.
+	SquashAware bool
+	// SinceDate, if set, only matches changed lines committed at or after
+	// SinceDate, and UntilDate, if set, only those committed before
+	// UntilDate, such as to audit changes made in the last sprint. Commit
+	// dates are read with git blame, at RevisionTo or the working tree,
+	// which is run once for each changed file, so can be slow for large
+	// patches. Uncommitted lines are treated as committed now, and new files
+	// aren't filtered. If git blame fails, such as for a file not in the
+	// repository, Check returns its error.
+	SinceDate time.Time
+	UntilDate time.Time
+	// StableKeys sets each issue's Key to a hash of its file name, message and
+	// the content of the 2 lines before and after it, read from the file
+	// relative to AbsPath. Keys are unaffected by lines added or removed
+	// elsewhere in the file, such as after a rebase, so issues can be compared
+	// between runs.
+	StableKeys bool
+	// ResolveSymbols sets each issue's Symbol, the name of the declaration
+	// enclosing it, in .go files, which are parsed from relative to AbsPath.
+	// Each file with issues is parsed once per Check, which may be slow for
+	// large files.
+	ResolveSymbols bool
+	// IncludeDeleted also matches issues on lines deleted by the patch, using
+	// line numbers from before the patch was applied, such as when the tool
+	// was run on the old tree.
+	IncludeDeleted bool
+	// TrailingContext also matches issues on up to this many unchanged
+	// context lines following the last change in each hunk, such as a closing
+	// brace after an added line. Unlike matching all of a hunk's context
+	// lines, the context before and between changes isn't matched. Ignored for
+	// combined diffs.
+	TrailingContext int
+	// MatchLeadingContext also matches issues on the unchanged context line
+	// immediately before the first change in each hunk, for the few tools
+	// which report an issue with an insertion on the line before it. Ignored
+	// for combined diffs.
+	MatchLeadingContext bool
+	// MergeHunkGap, if positive, merges hunks in a file separated by at most
+	// this many lines not in the patch, matching issues on all lines between
+	// the last added line of one and the first added line of the next, such
+	// as for linters reporting an issue at the start of an enclosing block.
+	// Merged hunks are a single hunk in HunkHeatmap, and lines between them
+	// have the HunkPos of the next added line, as they may not be in the
+	// patch. Larger gaps match more issues on unchanged lines. Ignored for
+	// combined diffs.
+	MergeHunkGap int
+	// LineMatch, if set, is called for each issue on a changed line, with the
+	// content of the added line, excluding the leading +, and only matches the
+	// issue if it returns true. For example, to only match issues naming a
+	// symbol on the added line. LineMatch isn't called for issues in new
+	// files.
+	LineMatch func(addedContent string, issue Issue) bool `json:"-"`
+	// IssueSink, if set, is called with each matched issue, such as to send
+	// issues to a log, in addition to them being written and returned. It's
+	// called once all issues are matched, sorted and filtered by PostFilters,
+	// with the issues returned, in order.
+	IssueSink func(issue Issue) `json:"-"`
+	// PostFilters, if set, are called in order with the matched issues, each
+	// with the result of the last, such as to sort, deduplicate or limit
+	// them. The issues returned by the last are written and returned. If
+	// set, issues in the text format are only written once all input has
+	// been read.
+	PostFilters []func(issues []Issue) []Issue `json:"-"`
+	// FirstPerFile only matches the first issue, in the order read, in each
+	// file.
+	FirstPerFile bool
+	// StrictNewFiles always fails issues in new files, even if other issues
+	// are only warnings, see ShouldFail.
+	StrictNewFiles bool
+	// RequireLinterSawAllFiles returns an error from Check if a changed .go
+	// file, including new files, isn't named by any line of the tool's output
+	// matching the regexp, whether or not the line is on a changed line, as
+	// the tool may have skipped it. It's only useful with tools which write
+	// a line for each file checked, even without issues.
+	RequireLinterSawAllFiles bool
+	// OutputAbsolute rewrites the path of each written issue to be absolute,
+	// by joining it with AbsPath, or if PreferGitPaths made it relative to
+	// the repository, the path the tool gave.
+	OutputAbsolute bool
+	// IncludeRaw includes the values captured by the regexp for each issue in
+	// the json format, as a "raw" object of each capture group's value, by
+	// name, or by number if unnamed, such as to debug a custom Regexp.
+	IncludeRaw bool
+	// Delimiter, if set, writes each issue in the text format as its file,
+	// line number, column number, or 0 if none, and message, separated by
+	// Delimiter, rather than as it appeared from the tool. For example, a tab
+	// for paths containing colons, such as Windows drives.
+	Delimiter string
+	// HunkPosMode sets each issue's HunkPos to either HunkPosPosition
+	// (default), matching GitHub's position, HunkPosLine or HunkPosChanged,
+	// see Issue.HunkPos.
+	HunkPosMode string
+	// PatchOffsets sets each issue's PatchOffset, its line number within the
+	// whole patch.
+	PatchOffsets bool
+	// SortByPatchOrder orders the matched issues as their lines appear in the
+	// patch, from top to bottom, such as for a top-down review of the diff,
+	// rather than the order they were read in. Issues on the same line stay
+	// in the order read, and issues in new files which aren't in the patch,
+	// such as untracked files, are last, ordered by file and line. Issues are
+	// sorted before PostFilters are called, and if set, issues in the text
+	// format are only written once all input has been read.
+	SortByPatchOrder bool
+	// Summary, if set, is filled in by Check with a summary of the run, such
+	// as for a CI dashboard. Input is read even if empty, so the patch's
+	// totals are known.
+	Summary *Summary `json:"-"`
+	// LinterSuccessCodes are the exit statuses, in addition to 0, of a
+	// linter run by CheckCommand which mean it ran successfully, such as 1
+	// for linters which exit with 1 when they report issues. Any other exit
+	// status is an error, as the linter likely crashed. If nil, every exit
+	// status is successful. Only used by CheckCommand.
+	LinterSuccessCodes []int
+
+	lastCommit map[string][]pos // changes in the last commit, see OnlyLastCommit
+	wholeFiles []string         // files from ChangedFilesList, see readPatch
+	patchRead  bool             // Patch was read from the revisions by WithPatch
 }
 
 // Issue contains metadata about an issue found.
 type Issue struct {
 	// File is the name of the file as it appeared from the patch.
-	File string
+	File string `json:"file"`
 	// LineNo is the line number of the file.
-	LineNo int
+	LineNo int `json:"lineNo"`
 	// ColNo is the column number or 0 if none could be parsed.
-	ColNo int
-	// HunkPos is position from file's first @@, for new files this will be the
-	// line number.
+	ColNo int `json:"colNo"`
+	// HunkPos is where to comment on the issue in a GitHub pull request, as
+	// set by Checker.HunkPosMode. With HunkPosPosition, it's the 1-based
+	// position from the line below the file's first @@, for the position
+	// parameter of the classic pull request review comments API, and for new
+	// files this will be the line number. With HunkPosLine, it's the line
+	// number in the file, for the line parameter of the newer API. With
+	// HunkPosChanged, it's the 1-based position among the file's added and
+	// removed lines, and for new files the line number.
 	//
 	// See also: https://developer.github.com/v3/pulls/comments/#create-a-comment
-	HunkPos int
+	HunkPos int `json:"hunkPos"`
+	// PatchOffset, if Checker.PatchOffsets is set, is the 1-based line number
+	// of the issue's line within the whole patch, for tools commenting on a
+	// patch by its line rather than the file's, or 0 if the line isn't in the
+	// patch, such as in new files.
+	PatchOffset int `json:"patchOffset,omitempty"`
+	// Symbol, if Checker.ResolveSymbols is set, is the name of the top-level
+	// declaration enclosing the issue in a Go file, such as "HandleRequest"
+	// for a function, "Server.Handle" for a method, or the name of a type,
+	// variable or constant, or empty if the issue isn't within one.
+	Symbol string `json:"symbol,omitempty"`
 	// Issue text as it appeared from the tool.
-	Issue string
+	Issue string `json:"issue"`
 	// Message is the issue without file name, line number and column number.
-	Message string
+	Message string `json:"message"`
+	// Severity is the severity of the issue, such as "error" or "warning",
+	// if captured by the regexp, see CompiledRegexp.
+	Severity string `json:"severity,omitempty"`
+	// Key identifies the issue by its content, see Checker.StableKeys.
+	Key string `json:"key,omitempty"`
+	// NewFile is true if the issue is in a new file, from Checker.NewFiles or
+	// a file created by the patch, rather than in an existing file, even if
+	// the whole file is matched, such as by Checker.WholeFileThreshold.
+	NewFile bool `json:"newFile,omitempty"`
+}
+
+// Validate returns an error if c's options are invalid, such as an unknown
+// Format, and is called by Check. Options which are valid, but likely a
+// mistake, such as setting both Patch and RevisionFrom, where the revisions
+// are ignored, are written as a warning to Debug, or returned as an error if
+// StrictValidation is set.
+func (c Checker) Validate() error {
+	if _, ok := formats[c.Format]; !ok && c.Format != "" {
+		return fmt.Errorf("unknown format: %q", c.Format)
+	}
+	if _, _, err := c.CompiledRegexp(); err != nil {
+		return err
+	}
+	if _, err := c.fileHeaderRegexp(); err != nil {
+		return err
+	}
+	switch c.HunkPosMode {
+	case "", HunkPosPosition, HunkPosLine, HunkPosChanged:
+	default:
+		return fmt.Errorf("unknown hunk position mode: %q", c.HunkPosMode)
+	}
+
+	if c.Patch != nil && !c.patchRead && (c.RevisionFrom != "" || c.RevisionTo != "") {
+		const warning = "revisions %q and %q are ignored as Patch is set"
+		if c.StrictValidation {
+			return fmt.Errorf(warning, c.RevisionFrom, c.RevisionTo)
+		}
+		c.debugf("warning: "+warning, c.RevisionFrom, c.RevisionTo)
+	}
+	return nil
 }
 
 // Check scans reader and writes any lines to writer that have been added in
@@ -72,69 +424,128 @@ type Issue struct {
 // File paths in reader must be relative to current working directory or
 // absolute.
 func (c Checker) Check(reader io.Reader, writer io.Writer) (issues []Issue, err error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	text := c.Format == "" || c.Format == "text"
+
+	// if there's no input, there's no point reading the patch, unless it's
+	// written
+	br := bufio.NewReader(reader)
+	if _, err := br.Peek(1); err == io.EOF && c.Format != "annotated-diff" && !c.IncludeRevisionMetadata && c.Summary == nil && !c.RequireLinterSawAllFiles {
+		c.debugf("no input, not reading patch")
+		if !text {
+			return nil, c.writeFormat(writer, nil, nil, nil, nil, nil)
+		}
+		return nil, nil
+	}
+	reader = br
+
 	// Check if patch is supplied, if not, retrieve from VCS
 	var (
 		writeAll  bool
+		all       []Issue                      // issues written when writeAll is set
+		raw       map[string]map[string]string // see IncludeRaw, by Issue.Issue
 		returnErr error
 	)
-	if c.Patch == nil {
-		c.Patch, c.NewFiles, err = GitPatch(c.RevisionFrom, c.RevisionTo)
+	revisions, vcs, err := c.readPatch()
+	if err != nil {
+		writeAll = true
+		returnErr = err
+	}
+
+	if c.Regexp == "" && c.Tool == "" && c.AutoDetectFormat {
+		c.Tool, reader, err = detectTool(reader)
 		if err != nil {
-			writeAll = true
-			returnErr = fmt.Errorf("could not read git repo: %s", err)
+			return nil, fmt.Errorf("could not detect tool: %s", err)
 		}
-		if c.Patch == nil {
-			writeAll = true
-			returnErr = errors.New("no version control repository found")
+		c.debugf("detected tool: %q", c.Tool)
+	}
+	lineRE, fields, err := c.CompiledRegexp()
+	if err != nil {
+		return nil, err
+	}
+	field := func(match [][]byte, name string) []byte {
+		if i, ok := fields[name]; ok {
+			return match[i]
 		}
+		return nil
 	}
 
-	// file.go:lineNo:colNo:message
-	// colNo is optional, strip spaces before message
-	lineRE := regexp.MustCompile(`(.*?\.go):([0-9]+):([0-9]+)?:?\s*(.*)`)
-	if c.Regexp != "" {
-		lineRE, err = regexp.Compile(c.Regexp)
-		if err != nil {
-			return nil, fmt.Errorf("could not parse regexp: %v", err)
-		}
+	if c.Debug != nil {
+		// the patch is parsed concurrently, serialise debug output
+		c.Debug = &lockedWriter{w: c.Debug}
 	}
 
-	// TODO consider lazy loading this, if there's nothing in stdin, no point
-	// checking for recent changes
-	linesChanged := c.linesChanged()
-	c.debugf("lines changed: %+v", linesChanged)
+	var patch bytes.Buffer // patch read, if annotated
+	if c.Format == "annotated-diff" && c.Patch != nil {
+		c.Patch = io.TeeReader(c.Patch, &patch)
+	}
+	m, err := c.newMatcher(vcs, revisions)
+	if err != nil {
+		returnErr = err
+	}
+	defer m.changes.wait()
 
-	absPath := c.AbsPath
-	if absPath == "" {
-		absPath, err = os.Getwd()
-		if err != nil {
-			returnErr = fmt.Errorf("could not get current working directory: %s", err)
+	// textLine returns issue as written in the text format
+	textLine := func(issue Issue) string {
+		line, file := issue.Issue, issue.File
+		if c.OutputAbsolute && !filepath.IsAbs(file) {
+			file = m.fsPath(file)
+			if loc := lineRE.FindStringSubmatchIndex(line); loc != nil {
+				i := fields[FieldFile]
+				line = line[:loc[2*i]] + file + line[loc[2*i+1]:]
+			}
 		}
+		if c.Delimiter != "" {
+			line = delimitedIssue(issue, file, c.Delimiter)
+		}
+		return line
 	}
 
+	// issues in the text format are written once all have been matched if
+	// they're filtered or reordered
+	deferText := c.PostFilters != nil || c.SortByPatchOrder
+
 	// Scan each line in reader and only write those lines if lines changed
 	scanner := bufio.NewScanner(reader)
+	if c.SplitMultiOnLine {
+		sep := c.MultiOnLineSeparator
+		if sep == "" {
+			sep = DefaultMultiOnLineSeparator
+		}
+		scanner.Split(scanMultiOnLine(lineRE, []byte(sep)))
+	}
+	var inputLines int
 	for scanner.Scan() {
+		if inputLines++; c.MaxInputLines > 0 && inputLines > c.MaxInputLines {
+			returnErr = fmt.Errorf("input exceeds %d lines, stopped reading", c.MaxInputLines)
+			break
+		}
 		line := lineRE.FindSubmatch(scanner.Bytes())
 		if line == nil {
 			c.debugf("cannot parse file+line number: %s", scanner.Text())
 			continue
 		}
 
-		if writeAll {
+		if writeAll && text {
 			fmt.Fprintln(writer, scanner.Text())
 			continue
 		}
 
-		// Make absolute path names relative
-		path := string(line[1])
-		if rel, err := filepath.Rel(absPath, path); err == nil {
-			c.debugf("rewrote path from %q to %q (absPath: %q)", path, rel, absPath)
-			path = rel
+		path := string(field(line, FieldFile))
+		if c.URLDecodePaths {
+			if decoded, err := url.PathUnescape(path); err != nil {
+				c.debugf("cannot decode path %q, using as is: %s", path, err)
+			} else {
+				path = decoded
+			}
 		}
+		path = m.relPath(path)
+		m.seen[path] = true
 
 		// Parse line number
-		lno, err := strconv.ParseUint(string(line[2]), 10, 64)
+		lno, err := c.parseNumber(field(line, FieldLine))
 		if err != nil {
 			c.debugf("cannot parse line number: %q", scanner.Text())
 			continue
@@ -142,138 +553,1469 @@ func (c Checker) Check(reader io.Reader, writer io.Writer) (issues []Issue, err
 
 		// Parse optional column number
 		var cno uint64
-		if len(line[3]) > 0 {
-			cno, err = strconv.ParseUint(string(line[3]), 10, 64)
+		if col := field(line, FieldCol); len(col) > 0 {
+			cno, err = c.parseNumber(col)
+			if err != nil && c.StrictColumnParse {
+				c.debugf("cannot parse column number, ignoring issue: %q", scanner.Text())
+				continue
+			}
 			if err != nil {
 				c.debugf("cannot parse column number: %q", scanner.Text())
 				// Ignore this error and continue
 			}
 		}
 
-		// Extract message
-		msg := string(line[4])
-
-		c.debugf("path: %q, lineNo: %v, colNo: %v, msg: %q", path, lno, cno, msg)
-
-		var (
-			fpos    pos
-			changed bool
-		)
-		if fchanges, ok := linesChanged[path]; ok {
-			// found file, see if lines matched
-			for _, pos := range fchanges {
-				if pos.lineNo == int(lno) {
-					fpos = pos
-					changed = true
-				}
+		if c.ByteOffsets {
+			line, col, err := m.sources.offsetPosition(m.fsPath(path), int(lno))
+			if err != nil {
+				c.debugf("cannot convert byte offset, ignoring issue: %s: %q", err, scanner.Text())
+				continue
 			}
-			if changed || fchanges == nil {
-				// either file changed or it's a new file
-				issue := Issue{
-					File:    path,
-					LineNo:  fpos.lineNo,
-					ColNo:   int(cno),
-					HunkPos: fpos.lineNo,
-					Issue:   scanner.Text(),
-					Message: msg,
-				}
-				if changed {
-					// existing file changed
-					issue.HunkPos = fpos.hunkPos
-				}
-				issues = append(issues, issue)
-				fmt.Fprintln(writer, scanner.Text())
+			lno = uint64(line)
+			if cno == 0 {
+				cno = uint64(col)
 			}
 		}
-		if !changed {
-			c.debugf("unchanged: %s", scanner.Text())
+
+		issue := Issue{
+			File:     path,
+			LineNo:   int(lno),
+			ColNo:    int(cno),
+			Issue:    scanner.Text(),
+			Message:  string(field(line, FieldMessage)),
+			Severity: c.normalizeSeverity(string(field(line, FieldSeverity))),
+		}
+		if c.IncludeRaw {
+			if raw == nil {
+				raw = make(map[string]map[string]string)
+			}
+			raw[issue.Issue] = rawGroups(lineRE, line)
+		}
+
+		c.debugf("path: %q, lineNo: %v, colNo: %v, msg: %q", issue.File, issue.LineNo, issue.ColNo, issue.Message)
+
+		if writeAll {
+			// unfiltered issues are written, but not returned
+			all = append(all, issue)
+			continue
+		}
+
+		if issue, ok := m.match(issue); ok && text && !deferText {
+			fmt.Fprintln(writer, textLine(issue))
 		}
 	}
 	if err := scanner.Err(); err != nil {
 		returnErr = fmt.Errorf("error reading standard input: %s", err)
 	}
+	issues, returnErr = m.finish(returnErr)
+	if text && deferText {
+		for _, issue := range issues {
+			fmt.Fprintln(writer, textLine(issue))
+		}
+	}
+	if !text {
+		written := issues
+		if writeAll {
+			written = all
+		}
+		if err := c.writeFormat(writer, written, revisions, patch.Bytes(), m.changes.files, raw); err != nil {
+			returnErr = fmt.Errorf("could not write issues: %s", err)
+		}
+	}
 	return issues, returnErr
 }
 
+// readPatch sets Patch, if not set, to the patch from ChangedFilesList or a
+// VCS, and any options which depend on the repository, and returns the
+// revisions and name of the VCS the patch was read from, if known. An error
+// is returned if the patch couldn't be read.
+func (c *Checker) readPatch() (revisions *Revisions, vcs string, err error) {
+	if c.Patch == nil && c.ChangedFilesList != nil {
+		c.Patch = bytes.NewReader(nil)
+		c.wholeFiles = c.changedFiles()
+	}
+	if c.Patch != nil {
+		return nil, "", nil
+	}
+
+	vcs, revisions, err = c.vcsPatch()
+	if err != nil {
+		return revisions, vcs, fmt.Errorf("could not read %s repo: %s", vcs, err)
+	}
+	if c.Patch == nil {
+		return revisions, vcs, errors.New("no version control repository found")
+	}
+	return revisions, vcs, nil
+}
+
+// matcher matches issues against the changes in a patch, for Check and
+// FilterIssues, collecting the matched issues.
+type matcher struct {
+	c         Checker
+	changes   *changes
+	absPath   string
+	vcs       string     // name of the VCS the patch was read from
+	revisions *Revisions // revisions the patch was read from, if known
+
+	modules    []string          // module roots, see ModuleAware
+	gitPaths   map[string]string // see PreferGitPaths
+	files      map[string]string // paths on disk of files rewritten by PreferGitPaths
+	seen       map[string]bool   // files in the input, see RequireLinterSawAllFiles
+	reported   map[string]bool   // files with issues, see FirstPerFile
+	sources    *sources
+	sourceErrs map[string]bool // paths whose source errors were logged
+
+	issues     []Issue
+	patchLines []int // line number of each issue within the patch, if known
+}
+
+// newMatcher returns a matcher of the changes in Patch, which are parsed
+// concurrently, read from vcs between revisions. If an error is returned,
+// the current directory couldn't be found, but the matcher is still usable.
+func (c Checker) newMatcher(vcs string, revisions *Revisions) (*matcher, error) {
+	m := &matcher{
+		c:          c,
+		changes:    c.streamChanges(),
+		vcs:        vcs,
+		revisions:  revisions,
+		gitPaths:   make(map[string]string),
+		files:      make(map[string]string),
+		seen:       make(map[string]bool),
+		reported:   make(map[string]bool),
+		sources:    newSources(),
+		sourceErrs: make(map[string]bool),
+	}
+	var err error
+	m.absPath, err = c.absPath()
+	if c.ModuleAware && err == nil {
+		if m.modules, err = moduleRoots(m.absPath); err != nil {
+			c.debugf("could not find modules: %s", err)
+			err = nil
+		}
+	}
+	return m, err
+}
+
+// relPath returns path, an issue's file name, relative to AbsPath, or as
+// configured by PreferGitPaths and ModuleAware, to match the patch.
+func (m *matcher) relPath(path string) string {
+	c := m.c
+	// Make absolute path names relative
+	if full, ok := c.gitPath(m.gitPaths, m.absPath, path); ok {
+		c.debugf("rewrote path from %q to %q relative to the git repository", path, full)
+		if filepath.IsAbs(path) {
+			m.files[full] = path
+		} else {
+			m.files[full] = filepath.Join(m.absPath, path)
+		}
+		path = full
+	} else if rel, err := filepath.Rel(m.absPath, path); err == nil {
+		c.debugf("rewrote path from %q to %q (absPath: %q)", path, rel, m.absPath)
+		path = rel
+	}
+	// Tools such as go vet may prefix relative paths with ./
+	path = strings.TrimPrefix(path, "./")
+	if c.ModuleAware {
+		if rel := modulePath(m.modules, m.absPath, path); rel != path {
+			c.debugf("rewrote path from %q to %q relative to its module", path, rel)
+			path = rel
+		}
+	}
+	return path
+}
+
+// fsPath returns the path on disk of file, an issue's File from relPath.
+func (m *matcher) fsPath(file string) string {
+	if path, ok := m.files[file]; ok {
+		return path
+	}
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(m.absPath, file)
+}
+
+// match reports whether issue, whose File is relative to the patch, see
+// relPath, is on a changed line, and if so, returns it with the fields set
+// by Check, such as HunkPos, and records it to be returned by finish.
+func (m *matcher) match(issue Issue) (Issue, bool) {
+	c := m.c
+	if issue.File == "" {
+		c.debugf("empty file name, ignoring issue: %s", issue.Issue)
+		return issue, false
+	}
+	m.seen[issue.File] = true
+
+	fchanges, ok := m.changes.get(issue.File)
+	if !ok {
+		c.debugf("unchanged: %s", issue.Issue)
+		return issue, false
+	}
+
+	// found file, see if lines matched
+	var (
+		fpos    pos
+		changed bool
+	)
+	for _, pos := range fchanges {
+		if pos.lineNo == issue.LineNo {
+			fpos = pos
+			changed = true
+		}
+	}
+	if fchanges == nil {
+		// new file, so every line is changed
+		fpos = pos{lineNo: issue.LineNo, hunkPos: issue.LineNo, changedPos: issue.LineNo}
+	} else if !changed {
+		c.debugf("unchanged: %s", issue.Issue)
+		return issue, false
+	}
+	issue.LineNo = fpos.lineNo
+	issue.HunkPos = c.hunkPos(fpos)
+	issue.PatchOffset = c.patchOffset(fpos)
+	if changed && c.LineMatch != nil && !c.LineMatch(fpos.content, issue) {
+		c.debugf("line match rejected: %s", issue.Issue)
+		return issue, false
+	}
+
+	// either file changed or it's a new file
+	issue.NewFile = m.changes.newFile(issue.File)
+	if c.FirstPerFile {
+		if m.reported[issue.File] {
+			c.debugf("already reported issue in %q: %s", issue.File, issue.Issue)
+			return issue, false
+		}
+		m.reported[issue.File] = true
+	}
+	// source files which can't be read or parsed, such as when they're
+	// being edited, are still checked, without the options which need
+	// their source
+	path := m.fsPath(issue.File)
+	if c.StableKeys {
+		key, err := m.sources.stableKey(path, issue)
+		if err != nil && !m.sourceErrs[issue.File] {
+			c.debugf("could not compute stable keys for %q: %s", issue.File, err)
+			m.sourceErrs[issue.File] = true
+		}
+		issue.Key = key
+	}
+	if c.ResolveSymbols && strings.HasSuffix(issue.File, ".go") {
+		symbol, err := m.sources.symbol(path, issue.LineNo)
+		if err != nil && !m.sourceErrs[issue.File] {
+			c.debugf("could not resolve all symbols in %q: %s", issue.File, err)
+			m.sourceErrs[issue.File] = true
+		}
+		issue.Symbol = symbol
+	}
+	m.issues = append(m.issues, issue)
+	m.patchLines = append(m.patchLines, fpos.patchLine)
+	return issue, true
+}
+
+// finish waits for the patch to be parsed, and returns the matched issues,
+// sorted and filtered, and err, or the first error from the patch or the
+// options checked once all issues are matched. Summary is filled in, if set.
+func (m *matcher) finish(err error) ([]Issue, error) {
+	c := m.c
+	if perr := m.changes.wait(); perr != nil && err == nil {
+		err = perr
+	}
+	issues := m.issues
+	if c.SortByPatchOrder {
+		sortByPatchOrder(issues, m.patchLines)
+	}
+	for _, filter := range c.PostFilters {
+		issues = filter(issues)
+	}
+	if c.IssueSink != nil {
+		for _, issue := range issues {
+			c.IssueSink(issue)
+		}
+	}
+	if c.RequireLinterSawAllFiles && err == nil {
+		var unseen []string
+		for file := range m.changes.files {
+			if strings.HasSuffix(file, ".go") && !m.seen[file] {
+				unseen = append(unseen, file)
+			}
+		}
+		if unseen != nil {
+			sort.Strings(unseen)
+			err = fmt.Errorf("tool's output didn't name changed files: %s", strings.Join(unseen, ", "))
+		}
+	}
+	if c.Summary != nil {
+		*c.Summary = c.summarize(m.changes.files, m.absPath, issues, m.vcs, m.revisions)
+	}
+	return issues, err
+}
+
+// sortByPatchOrder sorts issues, in place, by the line number within the patch
+// of each issue, patchLines, where 0 is unknown, see SortByPatchOrder.
+func sortByPatchOrder(issues []Issue, patchLines []int) {
+	order := make([]int, len(issues))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		switch {
+		case patchLines[a] != 0 && patchLines[b] != 0:
+			return patchLines[a] < patchLines[b]
+		case patchLines[a] != 0 || patchLines[b] != 0:
+			return patchLines[a] != 0
+		case issues[a].File != issues[b].File:
+			return issues[a].File < issues[b].File
+		}
+		return issues[a].LineNo < issues[b].LineNo
+	})
+
+	sorted := make([]Issue, len(issues))
+	for i, j := range order {
+		sorted[i] = issues[j]
+	}
+	copy(issues, sorted)
+}
+
+// Fields captured by the regexp matching issues, see CompiledRegexp.
+const (
+	FieldFile     = "file"
+	FieldLine     = "line"
+	FieldCol      = "col"
+	FieldMessage  = "message"
+	FieldSeverity = "severity" // only captured by a named group
+)
+
+// CompiledRegexp returns the regexp matching issues, from Regexp, Tool, or
+// DefaultTool if neither are set, and a map of each field to the index of
+// its capture group. If the regexp has a group named "file", the groups named
+// "file", "line", "col", "message" and "severity" are used, else groups 1 to
+// 4 are the file, line, col and message respectively. Fields without a group,
+// except file and line which are required, aren't in the map.
+// AutoDetectFormat isn't used, as detection requires the tool's output.
+func (c Checker) CompiledRegexp() (*regexp.Regexp, map[string]int, error) {
+	lineRE, _ := toolPattern(DefaultTool)
+	switch {
+	case c.Regexp != "":
+		var err error
+		lineRE, err = regexp.Compile(c.Regexp)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not parse regexp: %v", err)
+		}
+	case c.Tool != "":
+		var ok bool
+		if lineRE, ok = toolPattern(c.Tool); !ok {
+			return nil, nil, fmt.Errorf("unknown tool: %q", c.Tool)
+		}
+	}
+	if c.PreserveMessageWhitespace && c.Regexp == "" {
+		var err error
+		if lineRE, err = preserveWhitespace(lineRE); err != nil {
+			return nil, nil, fmt.Errorf("cannot preserve message whitespace: %s", err)
+		}
+	}
+	if c.TolerantNumbers && c.Regexp == "" {
+		var err error
+		if lineRE, err = tolerantNumbers(lineRE); err != nil {
+			return nil, nil, fmt.Errorf("cannot tolerate thousands separators: %s", err)
+		}
+	}
+
+	fields := regexpFields(lineRE)
+	if _, ok := fields[FieldLine]; !ok {
+		return nil, nil, fmt.Errorf("regexp %q must capture file and line", lineRE)
+	}
+	return lineRE, fields, nil
+}
+
+// rawGroups returns the value of each of re's capture groups in match, see
+// IncludeRaw.
+func rawGroups(re *regexp.Regexp, match [][]byte) map[string]string {
+	raw := make(map[string]string)
+	for i, name := range re.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		raw[name] = string(match[i])
+	}
+	return raw
+}
+
+// regexpFields returns the index of each field's capture group in re, see
+// CompiledRegexp.
+func regexpFields(re *regexp.Regexp) map[string]int {
+	names := []string{FieldFile, FieldLine, FieldCol, FieldMessage}
+
+	fields := make(map[string]int)
+	for i, name := range re.SubexpNames() {
+		for _, field := range append(names, FieldSeverity) {
+			if name == field {
+				fields[field] = i
+			}
+		}
+	}
+	if _, ok := fields[FieldFile]; ok {
+		return fields
+	}
+
+	fields = make(map[string]int)
+	for i, name := range names {
+		if i+1 <= re.NumSubexp() {
+			fields[name] = i + 1
+		}
+	}
+	return fields
+}
+
+// absPath returns AbsPath, or the current working directory if not set.
+func (c Checker) absPath() (string, error) {
+	if c.AbsPath != "" {
+		return c.AbsPath, nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("could not get current working directory: %s", err)
+	}
+	return wd, nil
+}
+
+// gitPath returns path, relative to absPath if not absolute, relative to the
+// root of its git repository, see PreferGitPaths, and caches it in cache. If
+// PreferGitPaths isn't set or git doesn't know the file, false is returned.
+func (c Checker) gitPath(cache map[string]string, absPath, path string) (string, bool) {
+	if !c.PreferGitPaths || path == "" {
+		return "", false
+	}
+	full, ok := cache[path]
+	if !ok {
+		cmd := gitCommand(c.ReadOnlyGit, []string{"ls-files", "--full-name", "--cached", "--others", "--", path})
+		cmd.Dir = absPath
+		out, err := cmd.Output()
+		if err != nil {
+			c.debugf("could not find %q with git ls-files: %s", path, err)
+		}
+		if lines := strings.SplitN(string(out), "\n", 2); len(lines) > 1 {
+			full = lines[0]
+		}
+		cache[path] = full
+	}
+	return full, full != ""
+}
+
+// ShouldFail reports whether issues, returned by Check, should fail the
+// check, such as with a non-zero exit status. If warnOnly is set, issues are
+// treated as warnings and don't fail the check, unless StrictNewFiles is set
+// and an issue is in a new file.
+func (c Checker) ShouldFail(issues []Issue, warnOnly bool) bool {
+	for _, issue := range issues {
+		if !warnOnly || (c.StrictNewFiles && issue.NewFile) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNumber parses a line or column number, removing any thousands
+// separators first if c.TolerantNumbers is set.
+func (c Checker) parseNumber(b []byte) (uint64, error) {
+	num := string(b)
+	if c.TolerantNumbers {
+		num = strings.NewReplacer("_", "", ",", "").Replace(num)
+	}
+	return strconv.ParseUint(num, 10, 64)
+}
+
 func (c Checker) debugf(format string, s ...interface{}) {
 	if c.Debug != nil {
-		fmt.Fprint(c.Debug, "DEBUG: ")
-		fmt.Fprintf(c.Debug, format+"\n", s...)
+		fmt.Fprintf(c.Debug, "DEBUG: "+format+"\n", s...)
 	}
 }
 
+// Modes of setting Issue.HunkPos, see Checker.HunkPosMode.
+const (
+	// HunkPosPosition is the position from the line below the file's first
+	// @@ in the patch, for the position parameter of GitHub's classic pull
+	// request review comments API. Every line of the patch is counted,
+	// including the @@ headers of later hunks, context lines, and "\ No
+	// newline at end of file" markers, as GitHub does.
+	HunkPosPosition = "position"
+	// HunkPosLine is the line number in the file, for the line parameter of
+	// GitHub's newer pull request review comments API.
+	HunkPosLine = "line"
+	// HunkPosChanged is the position among the lines added or removed in
+	// the file, from 1, excluding @@ headers and context lines, for tools
+	// which only index changed lines.
+	HunkPosChanged = "changed"
+)
+
+// hunkPos returns the Issue.HunkPos of an issue at p, see HunkPosMode.
+func (c Checker) hunkPos(p pos) int {
+	switch c.HunkPosMode {
+	case HunkPosLine:
+		return p.lineNo
+	case HunkPosChanged:
+		return p.changedPos
+	}
+	return p.hunkPos
+}
+
+// patchOffset returns the Issue.PatchOffset of an issue at p, see
+// PatchOffsets. The line number within the patch is also tracked for
+// SortByPatchOrder and the annotated-diff format, but only set if
+// PatchOffsets is.
+func (c Checker) patchOffset(p pos) int {
+	if !c.PatchOffsets {
+		return 0
+	}
+	return p.patchLine
+}
+
 type pos struct {
-	lineNo  int // line number
-	hunkPos int // position relative to first @@ in file
+	lineNo     int    // line number
+	hunkPos    int    // position relative to first @@ in file
+	hunkStart  int    // line number the hunk starts at
+	patchLine  int    // line number within the whole patch, see Issue.PatchOffset
+	changedPos int    // position among changed lines in file, see HunkPosChanged
+	content    string // added line, only set if Checker.LineMatch is set
+	deleted    bool   // lineNo is a deleted line in the pre-image
+	unchanged  bool   // lineNo is matched but wasn't added, such as context
+}
+
+// addedLines returns the number of lines added in changes, excluding deleted
+// lines and lines matched without being added, such as context lines.
+func addedLines(changes []pos) int {
+	var n int
+	for _, p := range changes {
+		if !p.deleted && !p.unchanged {
+			n++
+		}
+	}
+	return n
+}
+
+// HunkHeatmap returns the number of issues in each hunk of the patch, read
+// from Patch, ChangedFilesList, or a VCS if neither is set, as a map of file
+// names to the line number each hunk starts at to the number of issues on
+// lines it changed. New files are a single hunk starting at line 1. Issues
+// not on changed lines, such as those matched by IncludeDeleted, aren't
+// counted. Patch must not have been read, such as by Check.
+func (c Checker) HunkHeatmap(issues []Issue) (map[string]map[int]int, error) {
+	changes, err := c.patchChanges()
+	if err != nil {
+		return nil, err
+	}
+
+	heatmap := make(map[string]map[int]int)
+	for _, issue := range issues {
+		fchanges, ok := changes[issue.File]
+		if !ok {
+			continue
+		}
+		start := 0
+		if fchanges == nil {
+			start = 1
+		}
+		for _, p := range fchanges {
+			if p.lineNo == issue.LineNo && !p.deleted {
+				start = p.hunkStart
+			}
+		}
+		if start == 0 {
+			continue
+		}
+		if heatmap[issue.File] == nil {
+			heatmap[issue.File] = make(map[int]int)
+		}
+		heatmap[issue.File][start]++
+	}
+	return heatmap, nil
+}
+
+// ChangedLineCount returns the number of lines added in the patch, read from
+// Patch, ChangedFilesList, or a VCS if neither is set, such as to decide
+// whether to run a linter at all. The lines of each new file are counted, as
+// read relative to AbsPath.
+func (c Checker) ChangedLineCount() (int, error) {
+	absPath, err := c.absPath()
+	if err != nil {
+		return 0, err
+	}
+	files, err := c.patchChanges()
+	if err != nil {
+		return 0, err
+	}
+	return countChangedLines(files, absPath)
+}
+
+// ChangedFiles returns the names of the files changed in the patch, read from
+// Patch, ChangedFilesList, or a VCS if neither is set, and NewFiles, in
+// ascending order, such as to only run a linter on those files. Deleted files,
+// and files without lines issues could be matched on, such as files not
+// changed in the last commit with OnlyLastCommit, are excluded. Names are as
+// in the patch, relative to the root of the repository.
+func (c Checker) ChangedFiles() ([]string, error) {
+	files, err := c.patchChanges()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for file, fchanges := range files {
+		if file != "" && (fchanges == nil || len(fchanges) > 0) {
+			names = append(names, file)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// WithPatch returns a copy of c with Patch, if not set, read from
+// ChangedFilesList or a VCS, as Check would, and the options which depend on
+// the repository, such as RevisionFrom if SquashAware is set. The patch can
+// then be read once, such as to check the output of multiple runs of a tool
+// against the same patch, without reading it from the VCS for each. The
+// revisions are kept, as they're used by options such as SinceDate, and
+// aren't reported by Validate as being ignored.
+func (c Checker) WithPatch() (Checker, error) {
+	read := c.Patch == nil
+	_, _, err := c.readPatch()
+	c.patchRead = read
+	return c, err
+}
+
+// patchChanges returns the positions to match issues against in each file in
+// the patch, read as Check reads it, from Patch, ChangedFilesList, or a VCS
+// if neither is set, with the options which depend on the repository, such
+// as OnlyLastCommit, see readPatch and fileChanges.
+func (c Checker) patchChanges() (map[string][]pos, error) {
+	if _, _, err := c.readPatch(); err != nil {
+		return nil, err
+	}
+
+	changes := c.newChanges()
+	if err := c.parsePatch(changes.add); err != nil {
+		return nil, err
+	}
+	return changes.files, nil
+}
+
+// countChangedLines returns the number of lines changed in files, a map of
+// file names, relative to absPath, to their changes, see ChangedLineCount.
+func countChangedLines(files map[string][]pos, absPath string) (int, error) {
+	var count int
+	for file, fchanges := range files {
+		if file == "" {
+			// deleted file, or an empty patch
+			continue
+		}
+		if fchanges == nil {
+			lines, err := countLines(filepath.Join(absPath, file))
+			if err != nil {
+				return 0, fmt.Errorf("could not count lines of new file: %s", err)
+			}
+			count += lines
+			continue
+		}
+		count += addedLines(fchanges)
+	}
+	return count, nil
+}
+
+// summarize returns the Summary of a run of Check which matched issues in
+// files, the changes read from a patch from vcs between revisions.
+func (c Checker) summarize(files map[string][]pos, absPath string, issues []Issue, vcs string, revisions *Revisions) Summary {
+	summary := Summary{
+		Issues:    len(issues),
+		VCS:       vcs,
+		Revisions: revisions,
+	}
+	for file := range files {
+		if file != "" {
+			summary.FilesChanged++
+		}
+	}
+	var err error
+	if summary.LinesChanged, err = countChangedLines(files, absPath); err != nil {
+		c.debugf("could not count lines changed: %s", err)
+	}
+	for _, issue := range issues {
+		if issue.Severity == "" {
+			continue
+		}
+		if summary.IssuesBySeverity == nil {
+			summary.IssuesBySeverity = make(map[string]int)
+		}
+		summary.IssuesBySeverity[issue.Severity]++
+	}
+	return summary
 }
 
 // linesChanges returns a map of file names to line numbers being changed.
 // If key is nil, the file has been recently added, else it contains a slice
 // of positions that have been added.
 func (c Checker) linesChanged() map[string][]pos {
-	type state struct {
-		file    string
-		lineNo  int   // current line number within chunk
-		hunkPos int   // current line count since first @@ in file
-		changes []pos // position of changes
+	changes := c.newChanges()
+	if err := c.parsePatch(changes.add); err != nil {
+		c.debugf("%s", err)
 	}
+	return changes.files
+}
+
+// streamChanges is like linesChanged, but parses the patch in a separate
+// goroutine, allowing changes to be looked up as soon as each file has been
+// parsed.
+func (c Checker) streamChanges() *changes {
+	changes := c.newChanges()
+	go func() {
+		err := c.parsePatch(func(file string, fchanges []pos, newFile bool) {
+			c.debugf("lines changed in %q: %+v", file, fchanges)
+			changes.add(file, fchanges, newFile)
+		})
+		changes.finish(err)
+	}()
+	return changes
+}
 
+// parsePatch reads Checker.Patch and calls found with the positions changed
+// in each file, as soon as all of the file's changes have been read. If the
+// patch couldn't be completely read, found is called with the changes read
+// and an error is returned.
+func (c Checker) parsePatch(found func(file string, changes []pos, newFile bool)) error {
 	var (
-		s       state
-		changes = make(map[string][]pos)
+		s       patchState
+		devNull bool // the file's --- line was /dev/null, so it's new
 	)
 
-	for _, file := range c.NewFiles {
-		changes[file] = nil
+	if c.Patch == nil {
+		return nil
 	}
 
-	if c.Patch == nil {
-		return changes
+	headerRE, err := c.fileHeaderRegexp()
+	if err != nil {
+		return err
+	}
+
+	added, removed := c.AddedMarker, c.RemovedMarker
+	if added == "" {
+		added = "+"
+	}
+	if removed == "" {
+		removed = "-"
+	}
+
+	// record passes the changes read for a file to found, returning any
+	// error filtering them, after which the patch isn't read further
+	record := func(s patchState) error {
+		changes, err := c.fileChanges(s.file, s.changes, s.newFile)
+		found(s.file, changes, s.newFile)
+		return err
 	}
 
 	scanner := bufio.NewScanner(c.Patch)
+	if c.LineSplit != nil {
+		scanner.Split(c.LineSplit)
+	}
+	var patchLine int // line number within the whole patch
 	for scanner.Scan() {
 		line := scanner.Text() // TODO scanner.Bytes()
 		c.debugf(line)
+		if c.PatchOffsets || c.SortByPatchOrder || c.Format == "annotated-diff" {
+			patchLine++
+			s.patchLine = patchLine
+		}
 		s.lineNo++
 		s.hunkPos++
+		if line == "--- /dev/null" && s.oldRemaining == 0 {
+			devNull = true
+		}
 		switch {
-		case strings.HasPrefix(line, "+++ ") && len(line) > 4:
+		case headerRE != nil && headerRE.MatchString(line):
+			if s.changes != nil {
+				// record the last state
+				if err := record(s); err != nil {
+					return err
+				}
+			}
+			file := headerRE.FindStringSubmatch(line)[1]
+			s = patchState{file: file, hunkPos: -1, changes: []pos{}, header: true, newFile: devNull}
+		case headerRE != nil && s.header && !strings.HasPrefix(line, "@@"):
+			// skip the file header's lines before the first hunk, such as
+			// --- and +++, which aren't boundaries in this dialect
+			s.hunkPos = -1
+			s.newFile = s.newFile || devNull
+			devNull = false
+		case headerRE == nil && strings.HasPrefix(line, "rename to "):
+			// renamed file, such as from git format-patch -M, which has no
+			// +++ line if its content is unchanged
 			if s.changes != nil {
 				// record the last state
-				changes[s.file] = s.changes
+				if err := record(s); err != nil {
+					return err
+				}
 			}
+			s = patchState{file: line[10:], hunkPos: -1, changes: []pos{}, renamed: true}
+		case headerRE == nil && strings.HasPrefix(line, "+++ ") && len(line) > 5:
 			// 6 removes "+++ b/"
-			s = state{file: line[6:], hunkPos: -1, changes: []pos{}}
-		case strings.HasPrefix(line, "@@ "):
-			//      @@ -1 +2,4 @@
-			// chdr ^^^^^^^^^^^^^
-			// ahdr       ^^^^
-			// cstart      ^
-			chdr := strings.Split(line, " ")
-			ahdr := strings.Split(chdr[2], ",")
-			// [1:] to remove leading plus
-			cstart, err := strconv.ParseUint(ahdr[0][1:], 10, 64)
+			file := line[6:]
+			if line[4:] == "/dev/null" {
+				// deleted file
+				file = ""
+			}
+			if s.renamed && s.file == file {
+				// content of the renamed file follows
+				s.renamed = false
+				s.hunkPos = -1
+				break
+			}
+			if s.changes != nil {
+				// record the last state
+				if err := record(s); err != nil {
+					return err
+				}
+			}
+			s = patchState{file: file, hunkPos: -1, changes: []pos{}, newFile: devNull}
+			devNull = false
+			if file == "" {
+				s.changes = nil
+			}
+		case strings.HasPrefix(line, "@@ ") || strings.HasPrefix(line, "@@@"):
+			h, err := parseHunkHeader(line)
 			if err != nil {
-				panic(err)
+				// record the changes read
+				record(s)
+				return fmt.Errorf("could not parse hunk header in %q: %s", s.file, err)
 			}
-			s.lineNo = int(cstart) - 1 // -1 as cstart is the next line number
-		case strings.HasPrefix(line, "-"):
+			s.parents = h.parents
+			s.lineNo = h.start - 1 // -1 as start is the next line number
+			s.header = false
+			prevStart := s.hunkStart
+			s.hunkStart = h.start
+
+			// hunks should be in order and not overlap, otherwise the patch
+			// is likely corrupt, such as from being edited by hand
+			count := h.count
+			if count > 0 && s.hunkStart <= s.hunkEnd {
+				c.debugf("warning: hunk %q in %q overlaps lines %d to %d of a previous hunk, the patch may be corrupt", line, s.file, s.hunkStart, s.hunkEnd)
+			}
+
+			// see MergeHunkGap
+			s.merge = c.MergeHunkGap > 0 && s.parents < 2 && s.lastAdded > 0 && s.hunkStart-s.hunkEnd-1 <= c.MergeHunkGap
+			if end := s.hunkStart + count - 1; end > s.hunkEnd {
+				s.hunkEnd = end
+			}
+			if s.merge {
+				s.hunkStart = prevStart
+			}
+
+			// track the pre-image's lines, see IncludeDeleted
+			s.oldLineNo = h.oldStart - 1
+			s.oldRemaining = h.oldCount
+			s.chunkChanged = false
+			s.leading = nil
+		case strings.HasPrefix(line, `\`):
+			// "\ No newline at end of file" marker of the previous line,
+			// which isn't a line of the file
+			s.lineNo--
+		case s.parents > 1:
+			// combined diff, with a column for each parent, lines removed
+			// from any parent aren't in the result, and lines added to any
+			// parent are changed in the result
+			cols := line
+			if len(cols) > s.parents {
+				cols = cols[:s.parents]
+			}
+			switch {
+			case strings.Contains(cols, "-"):
+				s.lineNo--
+				s.changedPos++
+			case strings.Contains(cols, "+"):
+				s.changedPos++
+				s.added(c, line[len(cols):])
+			}
+		case strings.HasPrefix(line, removed):
 			s.lineNo--
-		case strings.HasPrefix(line, "+"):
-			s.changes = append(s.changes, pos{lineNo: s.lineNo, hunkPos: s.hunkPos})
+			if s.oldRemaining > 0 {
+				s.change(c)
+				s.oldLineNo++
+				s.oldRemaining--
+				if c.IncludeDeleted {
+					p := s.pos(c)
+					p.lineNo, p.deleted = s.oldLineNo, true
+					s.changes = append(s.changes, p)
+				}
+			}
+		case strings.HasPrefix(line, added):
+			s.change(c)
+			s.added(c, line[len(added):])
+		case line == "" || strings.HasPrefix(line, " "):
+			if s.oldRemaining > 0 {
+				s.oldLineNo++
+				s.oldRemaining--
+				if c.TrailingContext > 0 || c.MatchLeadingContext {
+					s.contextLine(c, strings.TrimPrefix(line, " "))
+				}
+			}
 		}
 
 	}
+	// record the last state
+	if err := record(s); err != nil {
+		return err
+	}
 	if err := scanner.Err(); err != nil {
-		fmt.Fprintln(os.Stderr, "reading standard input:", err)
+		return fmt.Errorf("error reading patch: %s", err)
+	}
+	return nil
+}
+
+// hunkHeader is a hunk's header, such as "@@ -1 +2,4 @@".
+type hunkHeader struct {
+	parents  int // number of pre-images, more than 1 in combined diffs
+	start    int // line number of the first line of the hunk
+	count    int // number of lines in the hunk
+	oldStart int // line number of the first line in the first pre-image
+	oldCount int // number of lines in the first pre-image
+}
+
+// parseHunkHeader parses line, a hunk's header, such as "@@ -1 +2,4 @@".
+// Combined diffs, such as from git diff --cc, have an @ and a range for each
+// parent: "@@@ -1 -1 +2,4 @@@".
+func parseHunkHeader(line string) (hunkHeader, error) {
+	fields := strings.Split(line, " ")
+	h := hunkHeader{parents: len(fields[0]) - 1}
+	if strings.Trim(fields[0], "@") != "" || len(fields) < h.parents+2 {
+		return h, fmt.Errorf("malformed hunk header %q", line)
 	}
-	// record the last state
-	changes[s.file] = s.changes
 
+	// parse returns the start and count of the range r, prefixed by prefix
+	parse := func(r string, prefix byte) (start, count int, err error) {
+		if len(r) < 2 || r[0] != prefix {
+			return 0, 0, fmt.Errorf("malformed range %q in hunk header %q", r, line)
+		}
+		parts := strings.SplitN(r[1:], ",", 2)
+		count = 1
+		if start, err = strconv.Atoi(parts[0]); err == nil && len(parts) > 1 {
+			count, err = strconv.Atoi(parts[1])
+		}
+		if err != nil || start < 0 || count < 0 {
+			return 0, 0, fmt.Errorf("malformed range %q in hunk header %q", r, line)
+		}
+		return start, count, nil
+	}
+
+	var err error
+	if h.oldStart, h.oldCount, err = parse(fields[1], '-'); err != nil {
+		return h, err
+	}
+	h.start, h.count, err = parse(fields[h.parents+1], '+')
+	return h, err
+}
+
+// normalizeSeverity returns severity mapped by SeverityMap.
+func (c Checker) normalizeSeverity(severity string) string {
+	if mapped, ok := c.SeverityMap[severity]; ok {
+		return mapped
+	}
+	if mapped, ok := c.SeverityMap[strings.ToLower(severity)]; ok {
+		return mapped
+	}
+	return severity
+}
+
+// changedFiles returns ChangedFilesList with absolute paths made relative to
+// AbsPath, as in a patch.
+func (c Checker) changedFiles() []string {
+	absPath, err := c.absPath()
+	if err != nil {
+		c.debugf("could not make changed files relative: %s", err)
+		return c.ChangedFilesList
+	}
+	var files []string
+	for _, file := range c.ChangedFilesList {
+		if filepath.IsAbs(file) {
+			if rel, err := filepath.Rel(absPath, file); err == nil {
+				file = rel
+			}
+		}
+		files = append(files, filepath.Clean(file))
+	}
+	return files
+}
+
+// fileHeaderRegexp returns the compiled FileHeaderPattern, or nil if not set.
+func (c Checker) fileHeaderRegexp() (*regexp.Regexp, error) {
+	if c.FileHeaderPattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(c.FileHeaderPattern)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse file header pattern: %s", err)
+	}
+	if re.NumSubexp() < 1 {
+		return nil, fmt.Errorf("file header pattern %q must capture the file name", re)
+	}
+	return re, nil
+}
+
+// patchState is the state of parsePatch within a file.
+type patchState struct {
+	file       string
+	lineNo     int   // current line number within chunk
+	hunkPos    int   // current line count since first @@ in file
+	hunkStart  int   // line number the current hunk starts at
+	patchLine  int   // current line number within the whole patch
+	changedPos int   // current line count of changed lines in file
+	hunkEnd    int   // last line number of the file's hunks so far
+	lastAdded  int   // line number of the file's last added line so far
+	merge      bool  // hunk is merged with the last, see MergeHunkGap
+	parents    int   // number of parents in a combined diff's hunk
+	changes    []pos // position of changes
+	renamed    bool  // file is from a rename to line, and +++ not yet read
+	header     bool  // file is from FileHeaderPattern, and @@ not yet read
+	newFile    bool  // file is created by the patch, see Issue.NewFile
+
+	oldLineNo    int // current line number within chunk's pre-image
+	oldRemaining int // lines of the chunk's pre-image not yet read
+
+	chunkChanged bool  // a line has been added or removed in the chunk
+	context      []pos // context lines since the chunk's last change
+	leading      *pos  // last context line before the chunk's first change
+}
+
+// pos returns the position of the current line.
+func (s *patchState) pos(c Checker) pos {
+	p := pos{lineNo: s.lineNo, hunkPos: s.hunkPos, hunkStart: s.hunkStart, patchLine: s.patchLine}
+	if c.HunkPosMode == HunkPosChanged {
+		p.changedPos = s.changedPos
+	}
+	return p
+}
+
+// added records the current line, with content, as being added.
+func (s *patchState) added(c Checker, content string) {
+	if s.merge {
+		// lines between the last hunk's last added line and this one
+		for lineNo := s.lastAdded + 1; lineNo < s.lineNo; lineNo++ {
+			p := s.pos(c)
+			p.lineNo, p.unchanged = lineNo, true
+			s.changes = append(s.changes, p)
+		}
+		s.merge = false
+	}
+	s.lastAdded = s.lineNo
+	p := s.pos(c)
+	if c.LineMatch != nil {
+		p.content = content
+	}
+	s.changes = append(s.changes, p)
+}
+
+// change marks the chunk as changed by the current line, recording the
+// leading context line as changed if MatchLeadingContext is set.
+func (s *patchState) change(c Checker) {
+	s.changedPos++
+	if !s.chunkChanged && c.MatchLeadingContext && s.leading != nil {
+		s.changes = append(s.changes, *s.leading)
+	}
+	s.chunkChanged = true
+	s.context = nil
+	s.leading = nil
+}
+
+// contextLine records the current line, with content, as a context line,
+// which is changed if it's immediately before the chunk's first change and
+// MatchLeadingContext is set, or within TrailingContext lines of the end of
+// the chunk's last change, once the chunk has ended.
+func (s *patchState) contextLine(c Checker, content string) {
+	p := s.pos(c)
+	p.unchanged = true
+	if c.LineMatch != nil {
+		p.content = content
+	}
+	if !s.chunkChanged {
+		s.leading = &p
+	} else if c.TrailingContext > 0 {
+		s.context = append(s.context, p)
+	}
+	if s.oldRemaining == 0 {
+		if len(s.context) > c.TrailingContext {
+			s.context = s.context[:c.TrailingContext]
+		}
+		s.changes = append(s.changes, s.context...)
+		s.context = nil
+	}
+}
+
+// fileChanges returns the positions to match issues in file against, given
+// the positions changed in the patch, and whether the patch created file.
+func (c Checker) fileChanges(file string, changes []pos, newFile bool) ([]pos, error) {
+	changes = c.wholeFile(file, changes)
+	if c.lastCommit != nil {
+		last, ok := c.lastCommit[file]
+		if !ok {
+			// not changed in the last commit, and nil would be a new file
+			return []pos{}, nil
+		}
+		changes = intersectChanges(changes, last)
+	}
+	changes, err := c.withinDates(file, changes, newFile)
+	if err != nil {
+		return changes, err
+	}
+	if c.StatementAware && strings.HasSuffix(file, ".go") {
+		changes = c.statementChanges(file, changes)
+	}
+	return changes, nil
+}
+
+// intersectChanges returns the positions in changes whose line numbers were
+// also changed in other. Both may be nil, indicating a new file.
+func intersectChanges(changes, other []pos) []pos {
+	if other == nil {
+		return changes
+	}
+	lines := make(map[int]bool)
+	for _, pos := range other {
+		lines[pos.lineNo] = true
+	}
+
+	intersection := []pos{}
+	if changes == nil {
+		// new file, so position is the line number
+		for _, p := range other {
+			intersection = append(intersection, pos{lineNo: p.lineNo, hunkPos: p.lineNo})
+		}
+		return intersection
+	}
+	for _, pos := range changes {
+		if lines[pos.lineNo] {
+			intersection = append(intersection, pos)
+		}
+	}
+	return intersection
+}
+
+// wholeFile returns nil, marking the entire file as changed, if the ratio of
+// added lines to lines in file exceeds WholeFileThreshold, else changes.
+func (c Checker) wholeFile(file string, changes []pos) []pos {
+	added := addedLines(changes)
+	if c.WholeFileThreshold <= 0 || added == 0 {
+		return changes
+	}
+	absPath, err := c.absPath()
+	if err != nil {
+		c.debugf("could not check whole file threshold for %q: %s", file, err)
+		return changes
+	}
+	lines, err := countLines(filepath.Join(absPath, file))
+	if err != nil {
+		c.debugf("could not check whole file threshold for %q: %s", file, err)
+		return changes
+	}
+	if lines > 0 && float64(added)/float64(lines) > c.WholeFileThreshold {
+		c.debugf("treating %q as whole file, %d of %d lines changed", file, added, lines)
+		return nil
+	}
+	return changes
+}
+
+// countLines returns the number of lines in the file at path.
+func countLines(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var lines int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines++
+	}
+	return lines, scanner.Err()
+}
+
+// ScanAnyLines is a bufio.SplitFunc like bufio.ScanLines, but also treats a
+// lone \r as a line terminator, such as in files from classic Mac OS.
+func ScanAnyLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		// \r may be followed by \n, request more data
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// DefaultMultiOnLineSeparator is the separator of issues on a line used when
+// Checker.MultiOnLineSeparator isn't set.
+const DefaultMultiOnLineSeparator = ";"
+
+// scanMultiOnLine returns a bufio.SplitFunc like bufio.ScanLines, but which
+// splits lines into the issues separated by sep, if each matches re, see
+// Checker.SplitMultiOnLine.
+func scanMultiOnLine(re *regexp.Regexp, sep []byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		advance, line, err := bufio.ScanLines(data, atEOF)
+		if advance == 0 || err != nil {
+			return advance, line, err
+		}
+		parts := bytes.Split(line, sep)
+		if len(parts) == 1 {
+			return advance, line, nil
+		}
+		for _, part := range parts {
+			if !re.Match(bytes.TrimSpace(part)) {
+				return advance, line, nil
+			}
+		}
+		// the remaining issues on the line, without leading whitespace, are
+		// read next
+		space := len(parts[1]) - len(bytes.TrimLeft(parts[1], " \t"))
+		return len(parts[0]) + len(sep) + space, bytes.TrimSpace(parts[0]), nil
+	}
+}
+
+// newChanges returns changes containing NewFiles and the files of
+// ChangedFilesList, see readPatch.
+func (c Checker) newChanges() *changes {
+	changes := &changes{
+		files:    make(map[string][]pos),
+		newFiles: make(map[string]bool),
+		maxFiles: c.MaxChangedFiles,
+		debugf:   c.debugf,
+	}
+	changes.cond = sync.NewCond(&changes.mu)
+	for _, file := range c.NewFiles {
+		changes.add(file, nil, true)
+	}
+	for _, file := range c.wholeFiles {
+		changes.add(file, nil, false)
+	}
 	return changes
 }
 
+// changes holds the positions changed per file, as they're parsed from a
+// patch by streamChanges.
+type changes struct {
+	mu       sync.Mutex
+	cond     *sync.Cond // signalled when files or done change
+	files    map[string][]pos
+	newFiles map[string]bool // files which are new, see Issue.NewFile
+	done     bool            // patch has been completely parsed
+	err      error           // error parsing the patch, once done
+	maxFiles int             // see Checker.MaxChangedFiles
+	debugf   func(format string, s ...interface{})
+}
+
+// add records the positions changed in file, and whether it's new.
+func (c *changes) add(file string, changes []pos, newFile bool) {
+	c.mu.Lock()
+	c.files[file] = changes
+	if newFile {
+		c.newFiles[file] = true
+	}
+	if c.maxFiles > 0 && len(c.files) > c.maxFiles {
+		if len(c.files) == c.maxFiles+1 {
+			c.debugf("warning: more than %d files changed, treating all changed files as new files", c.maxFiles)
+			for file := range c.files {
+				c.files[file] = nil
+			}
+		}
+		c.files[file] = nil
+	}
+	c.mu.Unlock()
+	c.cond.Broadcast()
+}
+
+// finish marks the patch as completely parsed, with err, if any.
+func (c *changes) finish(err error) {
+	c.mu.Lock()
+	c.done = true
+	c.err = err
+	c.mu.Unlock()
+	c.cond.Broadcast()
+}
+
+// get returns the positions changed in file, see linesChanged. If file has
+// not yet been parsed, get blocks until it has been or the patch has been
+// completely parsed.
+func (c *changes) get(file string) ([]pos, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		// if limited, more files may be found which exceed the limit
+		limited := c.maxFiles > 0 && len(c.files) <= c.maxFiles
+		if fchanges, ok := c.files[file]; (ok && !limited) || c.done {
+			return fchanges, ok
+		}
+		c.cond.Wait()
+	}
+}
+
+// newFile reports whether file, once found by get, is new.
+func (c *changes) newFile(file string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.newFiles[file]
+}
+
+// wait blocks until the patch has been completely parsed, and returns the
+// error parsing it, if any.
+func (c *changes) wait() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for !c.done {
+		c.cond.Wait()
+	}
+	return c.err
+}
+
+// lockedWriter is an io.Writer safe for concurrent use.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// Summary is the totals of a run of Check, see Checker.Summary.
+type Summary struct {
+	// FilesChanged is the number of files changed, including new files.
+	FilesChanged int `json:"filesChanged"`
+	// LinesChanged is the number of lines changed, see ChangedLineCount.
+	LinesChanged int `json:"linesChanged"`
+	// Issues is the number of issues matched.
+	Issues int `json:"issues"`
+	// IssuesBySeverity is the number of issues matched with each severity,
+	// excluding those without a severity.
+	IssuesBySeverity map[string]int `json:"issuesBySeverity,omitempty"`
+	// VCS is the name of the VCS the patch was read from, or empty if Patch
+	// was set.
+	VCS string `json:"vcs,omitempty"`
+	// Revisions are the commits the patch was generated from, if known.
+	Revisions *Revisions `json:"revisions,omitempty"`
+}
+
+// Revisions are the commits a patch was generated from.
+type Revisions struct {
+	// From is the commit SHA the patch starts from.
+	From string `json:"from"`
+	// To is the commit SHA the patch finishes at, or empty if the patch
+	// includes changes in the working tree.
+	To string `json:"to,omitempty"`
+}
+
+// GitRevisions resolves the commit SHAs that GitPatch, given the same
+// arguments, generates a patch between. If revisionFrom is blank and there
+// are unstaged changes or untracked files, From is HEAD.
+func GitRevisions(revisionFrom, revisionTo string) (Revisions, error) {
+	return gitRevisions(revisionFrom, revisionTo, false)
+}
+
+// gitRevisions returns the revisions of GitRevisions, running git as
+// ReadOnlyGitPatch does if readOnly is set.
+func gitRevisions(revisionFrom, revisionTo string, readOnly bool) (Revisions, error) {
+	if revisionFrom == "" {
+		revisionFrom, revisionTo = "HEAD~", "HEAD"
+
+		ls, err := gitCommand(readOnly, []string{"ls-files", "-o"}).Output()
+		if err != nil {
+			return Revisions{}, fmt.Errorf("error executing git ls-files: %s", err)
+		}
+		var unstaged bool
+		if readOnly {
+			// git diff-files --quiet also exits with 1 for files whose stat
+			// info changed, as the index isn't refreshed, so check for a
+			// patch, as ReadOnlyGitPatch does
+			patch, err := gitCommand(true, nil, "diff-files", "-p", "-M").Output()
+			if err != nil {
+				return Revisions{}, fmt.Errorf("error executing git diff-files: %s", err)
+			}
+			unstaged = len(patch) > 0
+		} else {
+			// git diff --quiet exits with 1 when there are unstaged changes
+			unstaged = exec.Command("git", "diff", "--quiet").Run() != nil
+		}
+		if len(ls) > 0 || unstaged {
+			revisionFrom, revisionTo = "HEAD", ""
+		}
+	}
+
+	var (
+		revs Revisions
+		err  error
+	)
+	if revs.From, err = gitRevParse(revisionFrom, readOnly); err != nil {
+		return Revisions{}, err
+	}
+	if revisionTo != "" {
+		if revs.To, err = gitRevParse(revisionTo, readOnly); err != nil {
+			return Revisions{}, err
+		}
+	}
+	return revs, nil
+}
+
+// gitRevParse returns the SHA of the commit rev refers to.
+func gitRevParse(rev string, readOnly bool) (string, error) {
+	out, err := gitCommand(readOnly, []string{"rev-parse", "--verify", rev + "^{commit}"}).Output()
+	if err != nil {
+		return "", fmt.Errorf("error executing git rev-parse %q: %s", rev, err)
+	}
+	return string(bytes.TrimSpace(out)), nil
+}
+
+// gitMergeBase returns the SHA of the best common ancestor of revisionFrom
+// and revisionTo, or HEAD if revisionTo is blank.
+func gitMergeBase(revisionFrom, revisionTo string, readOnly bool) (string, error) {
+	if revisionTo == "" {
+		revisionTo = "HEAD"
+	}
+	out, err := gitCommand(readOnly, []string{"merge-base", revisionFrom, revisionTo}).Output()
+	if err != nil {
+		return "", fmt.Errorf("error executing git merge-base %q %q: %s", revisionFrom, revisionTo, err)
+	}
+	return string(bytes.TrimSpace(out)), nil
+}
+
+// gitLastCommitChanges returns the changes made in commit rev.
+func gitLastCommitChanges(rev string, readOnly bool) (map[string][]pos, error) {
+	var patch bytes.Buffer
+	cmd := gitCommand(readOnly, []string{"diff", rev + "~", rev}, "diff-tree", "-p", "-r", "-M", rev+"~", rev)
+	cmd.Stdout = &patch
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error executing git diff %q %q: %s", rev+"~", rev, err)
+	}
+	changes := make(map[string][]pos)
+	err := Checker{Patch: &patch}.parsePatch(func(file string, fchanges []pos, newFile bool) {
+		changes[file] = fchanges
+	})
+	return changes, err
+}
+
 // GitPatch returns a patch from a git repository, if no git repository was
 // was found and no errors occurred, nil is returned, else an error is returned
 // revisionFrom and revisionTo defines the git diff parameters, if left blank
@@ -282,18 +2024,70 @@ func (c Checker) linesChanged() map[string][]pos {
 // is not, untracked files will be included, to exclude untracked files set
 // revisionTo to HEAD~. It's incorrect to specify revisionTo without a
 // revisionFrom.
+//
+// Untracked files are listed, with git ls-files, unless both revisionFrom and
+// revisionTo are set, as they can't be part of a range of commits. If neither
+// are set and the repository has no commits, staged files are also listed as
+// new files, such as for a pre-commit check of the first commit.
 func GitPatch(revisionFrom, revisionTo string) (io.Reader, []string, error) {
+	return gitPatch(revisionFrom, revisionTo, false)
+}
+
+// ReadOnlyGitPatch is like GitPatch, but only runs git commands which don't
+// write to the index or take its lock, index.lock, so it can't contend with
+// other git commands running in the same repository. The plumbing commands
+// git diff-tree, to diff two commits, git diff-index, to diff a commit with
+// the working tree, and git diff-files, to diff the index with the working
+// tree, are used instead of git diff, detecting renames like git diff, and
+// git rev-parse --git-dir instead of git status, with $GIT_OPTIONAL_LOCKS set
+// to 0.
+func ReadOnlyGitPatch(revisionFrom, revisionTo string) (io.Reader, []string, error) {
+	return gitPatch(revisionFrom, revisionTo, true)
+}
+
+// gitCommand returns the git command args, or, if readOnly is set, the
+// plumbing command, if any, with $GIT_OPTIONAL_LOCKS set to 0, see
+// ReadOnlyGitPatch.
+func gitCommand(readOnly bool, args []string, plumbing ...string) *exec.Cmd {
+	if !readOnly {
+		return exec.Command("git", args...)
+	}
+	if plumbing != nil {
+		args = plumbing
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Env = append(os.Environ(), "GIT_OPTIONAL_LOCKS=0")
+	return cmd
+}
+
+// gitPatch returns the patch of GitPatch, or ReadOnlyGitPatch if readOnly is
+// set.
+func gitPatch(revisionFrom, revisionTo string, readOnly bool) (io.Reader, []string, error) {
 	var patch bytes.Buffer
 
+	git := func(args []string, plumbing ...string) *exec.Cmd {
+		return gitCommand(readOnly, args, plumbing...)
+	}
+
 	// check if git repo exists
-	if err := exec.Command("git", "status").Run(); err != nil {
+	if err := git([]string{"status"}, "rev-parse", "--git-dir").Run(); err != nil {
 		// don't return an error, we assume the error is not repo exists
 		return nil, nil, nil
 	}
 
+	if revisionFrom != "" && revisionTo != "" {
+		// untracked files can't be in a range of commits, so don't list them
+		cmd := git([]string{"diff", revisionFrom, revisionTo}, "diff-tree", "-p", "-r", "-M", revisionFrom, revisionTo)
+		cmd.Stdout = &patch
+		if err := cmd.Run(); err != nil {
+			return nil, nil, fmt.Errorf("error executing git diff %q %q: %s", revisionFrom, revisionTo, err)
+		}
+		return &patch, nil, nil
+	}
+
 	// make a patch for untracked files
 	var newFiles []string
-	ls, err := exec.Command("git", "ls-files", "-o").CombinedOutput()
+	ls, err := git([]string{"ls-files", "-o"}).CombinedOutput()
 	if err != nil {
 		return nil, nil, fmt.Errorf("error executing git ls-files: %s", err)
 	}
@@ -308,24 +2102,31 @@ func GitPatch(revisionFrom, revisionTo string) (io.Reader, []string, error) {
 	}
 
 	if revisionFrom != "" {
-		cmd := exec.Command("git", "diff", revisionFrom)
-		if revisionTo != "" {
-			cmd.Args = append(cmd.Args, revisionTo)
-		}
+		cmd := git([]string{"diff", revisionFrom}, "diff-index", "-p", "-M", revisionFrom)
 		cmd.Stdout = &patch
 		if err := cmd.Run(); err != nil {
-			return nil, nil, fmt.Errorf("error executing git diff %q %q: %s", revisionFrom, revisionTo, err)
+			return nil, nil, fmt.Errorf("error executing git diff %q: %s", revisionFrom, err)
 		}
+		return &patch, newFiles, nil
+	}
 
-		if revisionTo == "" {
-			return &patch, newFiles, nil
+	if err := git([]string{"rev-parse", "--verify", "--quiet", "HEAD"}).Run(); err != nil {
+		// no commits yet, so staged files are also new
+		ls, err := git([]string{"ls-files"}).Output()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error executing git ls-files: %s", err)
 		}
-		return &patch, nil, nil
+		for _, file := range bytes.Split(ls, []byte{'\n'}) {
+			if len(file) > 0 {
+				newFiles = append(newFiles, string(file))
+			}
+		}
+		return &patch, newFiles, nil
 	}
 
 	// make a patch for unstaged changes
 	// use --no-prefix to remove b/ given: +++ b/main.go
-	cmd := exec.Command("git", "diff")
+	cmd := git([]string{"diff"}, "diff-files", "-p", "-M")
 	cmd.Stdout = &patch
 	if err := cmd.Run(); err != nil {
 		return nil, nil, fmt.Errorf("error executing git diff: %s", err)
@@ -340,7 +2141,7 @@ func GitPatch(revisionFrom, revisionTo string) (io.Reader, []string, error) {
 
 	// check for changes in recent commit
 
-	cmd = exec.Command("git", "diff", "HEAD~")
+	cmd = git([]string{"diff", "HEAD~"}, "diff-index", "-p", "-M", "HEAD~")
 	cmd.Stdout = &patch
 	if err := cmd.Run(); err != nil {
 		return nil, nil, fmt.Errorf("error executing git diff HEAD~: %s", err)
@@ -3,6 +3,7 @@ package revgrep
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -10,6 +11,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func setup(t *testing.T, stage, subdir string) (prevwd string, sample []byte) {
@@ -48,10 +50,10 @@ func TestCheckerRegexp(t *testing.T) {
 		line   string
 		want   Issue
 	}{
-		{"", "file.go:1:issue", Issue{"file.go", 1, 0, 2, "file.go:1:issue", "issue"}},
-		{"", "file.go:1:5:issue", Issue{"file.go", 1, 5, 2, "file.go:1:5:issue", "issue"}},
-		{"", "file.go:1:  issue", Issue{"file.go", 1, 0, 2, "file.go:1:  issue", "issue"}},
-		{`.*?:(.*?\.go):([0-9]+):()(.*)`, "prefix:file.go:1:issue", Issue{"file.go", 1, 0, 2, "prefix:file.go:1:issue", "issue"}},
+		{"", "file.go:1:issue", Issue{File: "file.go", LineNo: 1, ColNo: 0, HunkPos: 2, Issue: "file.go:1:issue", Message: "issue"}},
+		{"", "file.go:1:5:issue", Issue{File: "file.go", LineNo: 1, ColNo: 5, HunkPos: 2, Issue: "file.go:1:5:issue", Message: "issue"}},
+		{"", "file.go:1:  issue", Issue{File: "file.go", LineNo: 1, ColNo: 0, HunkPos: 2, Issue: "file.go:1:  issue", Message: "issue"}},
+		{`.*?:(.*?\.go):([0-9]+):()(.*)`, "prefix:file.go:1:issue", Issue{File: "file.go", LineNo: 1, ColNo: 0, HunkPos: 2, Issue: "prefix:file.go:1:issue", Message: "issue"}},
 	}
 
 	diff := []byte(`--- a/file.go
@@ -78,6 +80,84 @@ func TestCheckerRegexp(t *testing.T) {
 	}
 }
 
+func TestCompiledRegexp(t *testing.T) {
+	tests := []struct {
+		regexp string
+		want   map[string]int
+	}{
+		{"", map[string]int{"file": 1, "line": 2, "col": 3, "message": 4}},
+		{`(.*?\.go):([0-9]+):(.*)`, map[string]int{"file": 1, "line": 2, "col": 3}},
+		{`(?P<message>.*) at (?P<file>.*?\.go) line (?P<line>[0-9]+)`, map[string]int{"file": 2, "line": 3, "message": 1}},
+		{`(?P<file>.*?\.go):(?P<line>[0-9]+): (?P<severity>\w+): (?P<message>.*)`, map[string]int{"file": 1, "line": 2, "severity": 3, "message": 4}},
+	}
+
+	for _, test := range tests {
+		re, have, err := Checker{Regexp: test.regexp}.CompiledRegexp()
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.regexp, err)
+			continue
+		}
+		if test.regexp != "" && re.String() != test.regexp {
+			t.Errorf("%q: unexpected regexp: %q", test.regexp, re)
+		}
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("%q: unexpected fields:\nhave: %v\nwant: %v", test.regexp, have, test.want)
+		}
+	}
+
+	if _, _, err := (Checker{Regexp: `(.*?\.go)`}).CompiledRegexp(); err == nil {
+		t.Error("expected error for regexp without line")
+	}
+
+	// named groups are used when matching
+	diff := []byte("--- a/file.go\n+++ b/file.go\n@@ -1,1 +1,1 @@\n-func Line() {}\n+func NewLine() {}")
+	checker := Checker{
+		Patch:  bytes.NewReader(diff),
+		Regexp: `(?P<message>.*) at (?P<file>.*?\.go) line (?P<line>[0-9]+)`,
+	}
+	issues, err := checker.Check(strings.NewReader("issue at file.go line 1"), ioutil.Discard)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	want := []Issue{{File: "file.go", LineNo: 1, HunkPos: 2, Issue: "issue at file.go line 1", Message: "issue"}}
+	if !reflect.DeepEqual(issues, want) {
+		t.Errorf("unexpected issues:\nhave: %#v\nwant: %#v", issues, want)
+	}
+}
+
+func TestCheckerOutputAbsolute(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,1 +1,1 @@
+-func Line() {}
++func NewLine() {}`)
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"file.go:1:issue", "/abs/file.go:1:issue\n"},
+		{"/abs/file.go:1:issue", "/abs/file.go:1:issue\n"},
+	}
+
+	for _, test := range tests {
+		checker := Checker{
+			Patch:          bytes.NewReader(diff),
+			AbsPath:        "/abs",
+			OutputAbsolute: true,
+		}
+
+		var out bytes.Buffer
+		_, err := checker.Check(bytes.NewReader([]byte(test.line)), &out)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if have := out.String(); have != test.want {
+			t.Errorf("unexpected output for line: %q\nhave: %q\nwant: %q", test.line, have, test.want)
+		}
+	}
+}
+
 // TestChangesReturn tests the writer in the argument to the Changes function
 // and generally tests the entire programs functionality.
 func TestChangesWriter(t *testing.T) {
@@ -87,6 +167,7 @@ func TestChangesWriter(t *testing.T) {
 		revFrom string
 		revTo   string
 	}{
+		"1-no-commits":           {"", []string{"main.go:3:"}, "", ""},
 		"2-untracked":            {"", []string{"main.go:3:"}, "", ""},
 		"3-untracked-subdir":     {"", []string{"main.go:3:", "subdir/main.go:3:"}, "", ""},
 		"3-untracked-subdir-cwd": {"subdir", []string{"main.go:3:"}, "", ""},
@@ -143,6 +224,197 @@ func TestChangesWriter(t *testing.T) {
 	}
 }
 
+func TestCheckerPreferGitPathsSubdir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "revgrep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	write := func(content string) {
+		if err := ioutil.WriteFile(filepath.Join(sub, "main.go"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init")
+	git("config", "user.name", "testdata")
+	git("config", "user.email", "testdata@example.com")
+	write("package main\n\nfunc main() {}\n")
+	git("add", ".")
+	git("commit", "-m", "Initial commit")
+	write("package main\nvar x int\nfunc main() {}\n")
+
+	prevwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(sub); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(prevwd)
+
+	var debug bytes.Buffer
+	checker := Checker{
+		PreferGitPaths: true,
+		OutputAbsolute: true,
+		StableKeys:     true,
+		ResolveSymbols: true,
+		Debug:          &debug,
+	}
+	var out bytes.Buffer
+	issues, err := checker.Check(strings.NewReader("main.go:2:1: x\n"), &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(issues) != 1 || issues[0].File != "sub/main.go" || issues[0].Key == "" || issues[0].Symbol != "x" {
+		t.Errorf("unexpected issues: %#v\n%s", issues, debug.String())
+	}
+	if have, want := out.String(), filepath.Join(sub, "main.go")+":2:1: x\n"; have != want {
+		t.Errorf("unexpected output: have %q want %q", have, want)
+	}
+}
+
+func TestCheckerOnlyLastCommit(t *testing.T) {
+	tests := []struct {
+		onlyLastCommit bool
+		revTo          string
+		want           []string
+	}{
+		{false, "", []string{"main.go:8", "main.go:9", "subdir/main.go:5"}},
+		// subdir/main.go only changed in the first commit
+		{true, "", []string{"main.go:9"}},
+		{true, "HEAD~1", []string{"main.go:8", "subdir/main.go:5"}},
+	}
+
+	for _, test := range tests {
+		prevwd, sample := setup(t, "13-last-commit", "")
+
+		checker := Checker{
+			RevisionFrom:   "HEAD~2",
+			RevisionTo:     test.revTo,
+			OnlyLastCommit: test.onlyLastCommit,
+		}
+		issues, err := checker.Check(bytes.NewReader(sample), ioutil.Discard)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		var have []string
+		for _, issue := range issues {
+			have = append(have, fmt.Sprintf("%s:%d", issue.File, issue.LineNo))
+		}
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("onlyLastCommit %v revTo %q: unexpected lines: have %v want %v", test.onlyLastCommit, test.revTo, have, test.want)
+		}
+		teardown(t, prevwd)
+	}
+}
+
+func TestCheckerSquashAware(t *testing.T) {
+	tests := []struct {
+		squashAware bool
+		revFrom     string
+		want        []int
+		wantErr     bool
+	}{
+		{false, "trunk", nil, false},
+		{true, "trunk", []int{8}, false},
+		{true, "unknown", nil, true}, // falls back to the unknown revision
+	}
+
+	for _, test := range tests {
+		prevwd, sample := setup(t, "15-squash-merge", "")
+
+		checker := Checker{
+			RevisionFrom: test.revFrom,
+			SquashAware:  test.squashAware,
+		}
+		issues, err := checker.Check(bytes.NewReader(sample), ioutil.Discard)
+		if (err != nil) != test.wantErr {
+			t.Errorf("revFrom %q: unexpected error: %v", test.revFrom, err)
+		}
+
+		var have []int
+		for _, issue := range issues {
+			have = append(have, issue.LineNo)
+		}
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("squashAware %v revFrom %q: unexpected lines: have %v want %v", test.squashAware, test.revFrom, have, test.want)
+		}
+		teardown(t, prevwd)
+	}
+}
+
+func TestCheckerPreferGitPaths(t *testing.T) {
+	prevwd, _ := setup(t, "8-unstaged", "")
+	defer teardown(t, prevwd)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	real, err := filepath.EvalSymlinks(wd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the repository is at a different path, as a bind mount may be
+	dir, err := ioutil.TempDir("", "revgrep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	link := filepath.Join(dir, "git")
+	if err := os.Symlink(real, link); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		preferGitPaths bool
+		want           []int
+	}{
+		{false, nil},
+		{true, []int{7}},
+	}
+
+	for _, test := range tests {
+		checker := Checker{
+			AbsPath:        link,
+			PreferGitPaths: test.preferGitPaths,
+		}
+		input := filepath.Join(real, "main.go") + ":7: changed\n" + filepath.Join(real, "main.go") + ":6: unchanged\n"
+		issues, err := checker.Check(strings.NewReader(input), ioutil.Discard)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		var have []int
+		for _, issue := range issues {
+			have = append(have, issue.LineNo)
+			if issue.File != "main.go" {
+				t.Errorf("unexpected file: %q", issue.File)
+			}
+		}
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("preferGitPaths %v: unexpected lines: have %v want %v", test.preferGitPaths, have, test.want)
+		}
+	}
+}
+
 func rewriteAbs(line string) string {
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -152,8 +424,14 @@ func rewriteAbs(line string) string {
 }
 
 func TestGitPatchNonGitDir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("could not get working dir: %s", err)
+	}
+	defer teardown(t, wd)
+
 	// Change to non-git dir
-	err := os.Chdir("/")
+	err = os.Chdir("/")
 	if err != nil {
 		t.Fatalf("could not chdir: %v", err)
 	}
@@ -170,6 +448,136 @@ func TestGitPatchNonGitDir(t *testing.T) {
 	}
 }
 
+func TestGitPatchRangeUntracked(t *testing.T) {
+	prevwd, _ := setup(t, "10-committed", "")
+	defer teardown(t, prevwd)
+
+	// main2.go is untracked
+	_, newFiles, err := GitPatch("HEAD~1", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"main2.go"}; !reflect.DeepEqual(newFiles, want) {
+		t.Errorf("unexpected newFiles: have %v want %v", newFiles, want)
+	}
+
+	_, newFiles, err = GitPatch("HEAD~1", "HEAD~0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if newFiles != nil {
+		t.Errorf("newFiles expected nil for range of commits, got: %v", newFiles)
+	}
+}
+
+func TestReadOnlyGitPatch(t *testing.T) {
+	prevwd, _ := setup(t, "14-commit-dates", "")
+	defer teardown(t, prevwd)
+	if err := ioutil.WriteFile("untracked.go", []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	revisions := [][2]string{{"", ""}, {"HEAD~1", ""}, {"HEAD~2", "HEAD~1"}}
+	var want []string
+	for _, revs := range revisions {
+		patch, newFiles, err := GitPatch(revs[0], revs[1])
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", revs, err)
+		}
+		b, _ := ioutil.ReadAll(patch)
+		want = append(want, fmt.Sprintf("%s%q", b, newFiles))
+	}
+
+	// simulate another git command holding the index lock, with a file
+	// whose stat info changed, which git would otherwise refresh in the
+	// index
+	if err := os.Chtimes("main.go", time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	lock := filepath.Join(".git", "index.lock")
+	if err := ioutil.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(lock)
+	index, err := ioutil.ReadFile(filepath.Join(".git", "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, revs := range revisions {
+		patch, newFiles, err := ReadOnlyGitPatch(revs[0], revs[1])
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", revs, err)
+		}
+		b, _ := ioutil.ReadAll(patch)
+		if have := fmt.Sprintf("%s%q", b, newFiles); have != want[i] {
+			t.Errorf("%q: unexpected patch:\nhave: %s\nwant: %s", revs, have, want[i])
+		}
+	}
+
+	if after, err := ioutil.ReadFile(filepath.Join(".git", "index")); err != nil || !bytes.Equal(after, index) {
+		t.Errorf("index was modified: %v", err)
+	}
+	if _, err := os.Stat(lock); err != nil {
+		t.Errorf("index lock was removed: %v", err)
+	}
+
+	// without the lock or other changes, git commands other than those
+	// reading the patch would otherwise refresh the index, as readme's stat
+	// info changed
+	if err := os.Remove(lock); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove("untracked.go"); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("git", "checkout", "--", "main.go").CombinedOutput(); err != nil {
+		t.Fatalf("could not checkout main.go: %v: %s", err, out)
+	}
+	if err := os.Chtimes("readme", time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if index, err = ioutil.ReadFile(filepath.Join(".git", "index")); err != nil {
+		t.Fatal(err)
+	}
+	checker := Checker{
+		ReadOnlyGit:    true,
+		RevisionFrom:   "HEAD~2",
+		OnlyLastCommit: true,
+		SquashAware:    true,
+		PreferGitPaths: true,
+		SinceDate:      time.Unix(1, 0),
+		Summary:        &Summary{},
+	}
+	if _, err := checker.Check(strings.NewReader("main.go:1: issue\n"), ioutil.Discard); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	revs, err := gitRevisions("", "", true)
+	if err != nil {
+		t.Errorf("unexpected error resolving revisions: %v", err)
+	}
+	if after, err := ioutil.ReadFile(filepath.Join(".git", "index")); err != nil || !bytes.Equal(after, index) {
+		t.Errorf("index was modified by checker: %v", err)
+	}
+	if want, err := GitRevisions("", ""); err != nil || revs != want {
+		t.Errorf("unexpected revisions: have %+v want %+v (%v)", revs, want, err)
+	}
+}
+
+func TestCheckerMalformedHunkHeader(t *testing.T) {
+	for _, header := range []string{"@@ -1 +x @@", "@@@", "@@ ", "@@ -1", "@@@ -1 +1 @@@", "@@ -1,y +1 @@"} {
+		diff := "--- a/file.go\n+++ b/file.go\n" + header + "\n+func NewLine() {}\n"
+		checker := Checker{Patch: strings.NewReader(diff)}
+		if _, err := checker.Check(strings.NewReader("file.go:1: issue\n"), ioutil.Discard); err == nil {
+			t.Errorf("%q: expected error", header)
+		}
+		checker.Patch = strings.NewReader(diff)
+		if _, err := checker.ChangedLineCount(); err == nil {
+			t.Errorf("%q: expected error counting changed lines", header)
+		}
+	}
+}
+
 func TestLinesChanged(t *testing.T) {
 	diff := []byte(`--- a/file.go
 +++ b/file.go
@@ -195,9 +603,9 @@ func TestLinesChanged(t *testing.T) {
 
 	want := map[string][]pos{
 		"file.go": []pos{
-			{lineNo: 2, hunkPos: 3},
-			{lineNo: 21, hunkPos: 7},
-			{lineNo: 30, hunkPos: 11},
+			{lineNo: 2, hunkPos: 3, hunkStart: 1},
+			{lineNo: 21, hunkPos: 7, hunkStart: 20},
+			{lineNo: 30, hunkPos: 11, hunkStart: 30},
 		},
 	}
 
@@ -205,3 +613,1499 @@ func TestLinesChanged(t *testing.T) {
 		t.Errorf("unexpected pos:\nhave: %#v\nwant: %#v", have, want)
 	}
 }
+
+// TestCheckStreamedPatch tests issues are matched the same regardless of the
+// order files appear in the patch and output, as the patch is parsed
+// concurrently with the output.
+func TestCheckStreamedPatch(t *testing.T) {
+	for _, reverse := range []bool{false, true} {
+		patch, output := largePatch(50, 10, reverse)
+
+		checker := Checker{Patch: bytes.NewReader(patch), Debug: ioutil.Discard}
+		issues, err := checker.Check(bytes.NewReader(output), ioutil.Discard)
+		if err != nil {
+			t.Errorf("reverse %v: unexpected error: %v", reverse, err)
+		}
+
+		checker = Checker{Patch: bytes.NewReader(patch)}
+		changes := checker.linesChanged()
+
+		var want []Issue
+		scanner := bufio.NewScanner(bytes.NewReader(output))
+		for scanner.Scan() {
+			var (
+				file string
+				line int
+			)
+			fmt.Sscanf(strings.Replace(scanner.Text(), ":", " ", -1), "%s %d", &file, &line)
+			for _, pos := range changes[file] {
+				if pos.lineNo == line {
+					want = append(want, Issue{File: file, LineNo: line, ColNo: 1, HunkPos: pos.hunkPos, Issue: scanner.Text(), Message: "issue"})
+				}
+			}
+		}
+
+		if !reflect.DeepEqual(issues, want) {
+			t.Errorf("reverse %v: unexpected issues:\nhave: %v\nwant: %v", reverse, issues, want)
+		}
+	}
+}
+
+// largePatch returns a patch changing every other line of n files and tool
+// output containing an issue for every line of those files, optionally in
+// reverse order.
+func largePatch(files, lines int, reverse bool) (patch, output []byte) {
+	var p, o bytes.Buffer
+	for f := 0; f < files; f++ {
+		fmt.Fprintf(&p, "--- a/file%d.go\n+++ b/file%d.go\n@@ -1,%d +1,%d @@\n", f, f, lines/2, lines)
+		for l := 1; l <= lines; l++ {
+			if l%2 == 0 {
+				fmt.Fprintf(&p, "+added line %d\n", l)
+			} else {
+				fmt.Fprintf(&p, " context line %d\n", l)
+			}
+		}
+	}
+	for i := 0; i < files; i++ {
+		f := i
+		if reverse {
+			f = files - 1 - i
+		}
+		for l := 1; l <= lines; l++ {
+			fmt.Fprintf(&o, "file%d.go:%d:1: issue\n", f, l)
+		}
+	}
+	return p.Bytes(), o.Bytes()
+}
+
+func BenchmarkCheck(b *testing.B) {
+	patch, output := largePatch(1000, 100, false)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		checker := Checker{Patch: bytes.NewReader(patch)}
+		if _, err := checker.Check(bytes.NewReader(output), ioutil.Discard); err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestLinesChangedLineSplit(t *testing.T) {
+	diff := "--- a/file.go\r+++ b/file.go\r@@ -1,2 +1,2 @@\r // comment\r-func Line() {}\r+func NewLine() {}\r"
+
+	want := map[string][]pos{
+		"file.go": []pos{{lineNo: 2, hunkPos: 3, hunkStart: 1}},
+	}
+
+	checker := Checker{
+		Patch:     strings.NewReader(diff),
+		LineSplit: ScanAnyLines,
+	}
+	if have := checker.linesChanged(); !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected pos:\nhave: %#v\nwant: %#v", have, want)
+	}
+
+	// mixed line endings
+	checker = Checker{
+		Patch:     strings.NewReader(strings.Replace(diff, "\r", "\r\n", 2)),
+		LineSplit: ScanAnyLines,
+	}
+	if have := checker.linesChanged(); !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected pos:\nhave: %#v\nwant: %#v", have, want)
+	}
+}
+
+func TestCheckerWholeFileThreshold(t *testing.T) {
+	dir, err := ioutil.TempDir("", "revgrep")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := "package main\nfunc A() {}\nfunc B() {}\nfunc C() {}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "file.go"), []byte(src), 0644); err != nil {
+		t.Fatalf("could not write file: %v", err)
+	}
+
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,4 +1,4 @@
+ package main
+-func X() {}
+-func Y() {}
+-func Z() {}
++func A() {}
++func B() {}
++func C() {}`)
+
+	tests := []struct {
+		threshold float64
+		want      []string
+	}{
+		{0, []string{"file.go:2:issue"}},
+		{0.8, []string{"file.go:2:issue"}},
+		{0.5, []string{"file.go:1:issue", "file.go:2:issue"}},
+	}
+
+	for _, test := range tests {
+		checker := Checker{
+			Patch:              bytes.NewReader(diff),
+			AbsPath:            dir,
+			WholeFileThreshold: test.threshold,
+		}
+
+		issues, err := checker.Check(strings.NewReader("file.go:1:issue\nfile.go:2:issue\n"), ioutil.Discard)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		var have []string
+		for _, issue := range issues {
+			have = append(have, issue.Issue)
+			if issue.NewFile {
+				t.Errorf("threshold %v: issue in modified file is in new file: %#v", test.threshold, issue)
+			}
+		}
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("threshold %v: unexpected issues\nhave: %q\nwant: %q", test.threshold, have, test.want)
+		}
+	}
+
+	// deleted lines and context aren't added lines
+	src = "package main\nfunc A() {}\nfunc B() {}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "file.go"), []byte(src), 0644); err != nil {
+		t.Fatalf("could not write file: %v", err)
+	}
+	diff = []byte(`--- a/file.go
++++ b/file.go
+@@ -1,4 +1,3 @@
+ package main
+-func X() {}
+-func Y() {}
++func A() {}
+ func B() {}`)
+	checker := Checker{
+		Patch:              bytes.NewReader(diff),
+		AbsPath:            dir,
+		WholeFileThreshold: 0.5,
+		IncludeDeleted:     true,
+		TrailingContext:    1,
+	}
+	issues, err := checker.Check(strings.NewReader("file.go:1:issue\nfile.go:2:issue\n"), ioutil.Discard)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(issues) != 1 || issues[0].LineNo != 2 {
+		t.Errorf("unexpected issues with deleted lines and context: %#v", issues)
+	}
+}
+
+func TestCheckerLineMatch(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,1 +1,2 @@
+-func Line() {}
++func NewLine() {}
++func OtherLine() {}`)
+
+	checker := Checker{
+		Patch: bytes.NewReader(diff),
+		LineMatch: func(addedContent string, issue Issue) bool {
+			return strings.Contains(addedContent, strings.TrimPrefix(issue.Message, "unused: "))
+		},
+	}
+
+	input := "file.go:1: unused: NewLine\nfile.go:2: unused: NewLine\nfile.go:2: unused: OtherLine\n"
+	issues, err := checker.Check(strings.NewReader(input), ioutil.Discard)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	var have []string
+	for _, issue := range issues {
+		have = append(have, issue.Issue)
+	}
+	want := []string{"file.go:1: unused: NewLine", "file.go:2: unused: OtherLine"}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected issues:\nhave: %q\nwant: %q", have, want)
+	}
+}
+
+func TestCheckerMaxChangedFiles(t *testing.T) {
+	patch, _ := largePatch(100, 4, false)
+
+	tests := []struct {
+		max  int
+		want int
+	}{
+		{0, 2},   // only changed lines
+		{100, 2}, // not exceeded
+		{99, 4},  // all lines in file
+	}
+
+	for _, test := range tests {
+		var debug bytes.Buffer
+		checker := Checker{
+			Patch:           bytes.NewReader(patch),
+			MaxChangedFiles: test.max,
+			Debug:           &debug,
+		}
+
+		input := "file0.go:1:issue\nfile0.go:2:issue\nfile99.go:3:issue\nfile99.go:4:issue\n"
+		issues, err := checker.Check(strings.NewReader(input), ioutil.Discard)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if len(issues) != test.want {
+			t.Errorf("max %d: unexpected issues %d, want %d: %v", test.max, len(issues), test.want, issues)
+		}
+		if warned := strings.Contains(debug.String(), "warning: more than"); warned != (test.want == 4) {
+			t.Errorf("max %d: unexpected warning %v", test.max, warned)
+		}
+	}
+}
+
+func TestLinesChangedCombined(t *testing.T) {
+	diff, err := ioutil.ReadFile(filepath.Join("testdata", "combined.diff"))
+	if err != nil {
+		t.Fatalf("could not read fixture: %v", err)
+	}
+
+	checker := Checker{
+		Patch: bytes.NewReader(diff),
+	}
+
+	have := checker.linesChanged()
+
+	want := map[string][]pos{
+		"main.go": []pos{
+			{lineNo: 3, hunkPos: 3, hunkStart: 1},
+			{lineNo: 4, hunkPos: 4, hunkStart: 1},
+			{lineNo: 5, hunkPos: 5, hunkStart: 1},
+		},
+	}
+
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected pos:\nhave: %#v\nwant: %#v", have, want)
+	}
+}
+
+func TestCheckerIncludeDeleted(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,4 +1,3 @@
+ // comment
+-func Deleted() {}
+ func Line() {}
+-func AlsoDeleted() {}
++func NewLine() {}
+--- a/other.go
++++ b/other.go
+@@ -1,1 +1,1 @@
+-func Line() {}
++func NewLine() {}`)
+
+	tests := []struct {
+		includeDeleted bool
+		want           []Issue
+	}{
+		{false, []Issue{
+			{File: "file.go", LineNo: 3, HunkPos: 5, Issue: "file.go:3:issue", Message: "issue"},
+		}},
+		{true, []Issue{
+			{File: "file.go", LineNo: 2, HunkPos: 2, Issue: "file.go:2:issue", Message: "issue"},
+			{File: "file.go", LineNo: 3, HunkPos: 5, Issue: "file.go:3:issue", Message: "issue"},
+			{File: "file.go", LineNo: 4, HunkPos: 4, Issue: "file.go:4:issue", Message: "issue"},
+		}},
+	}
+
+	for _, test := range tests {
+		checker := Checker{
+			Patch:          bytes.NewReader(diff),
+			IncludeDeleted: test.includeDeleted,
+		}
+
+		input := "file.go:1:issue\nfile.go:2:issue\nfile.go:3:issue\nfile.go:4:issue\n"
+		issues, err := checker.Check(strings.NewReader(input), ioutil.Discard)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(issues, test.want) {
+			t.Errorf("includeDeleted %v: unexpected issues:\nhave: %#v\nwant: %#v", test.includeDeleted, issues, test.want)
+		}
+	}
+}
+
+func TestCheckerFirstPerFile(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,1 +1,2 @@
+-func Line() {}
++func NewLine() {}
++func OtherLine() {}
+--- a/other.go
++++ b/other.go
+@@ -1,1 +1,1 @@
+-func Line() {}
++func NewLine() {}`)
+
+	checker := Checker{
+		Patch:        bytes.NewReader(diff),
+		FirstPerFile: true,
+	}
+
+	var out bytes.Buffer
+	input := "file.go:2:first\nfile.go:1:second\nother.go:1:first\nfile.go:2:third\n"
+	issues, err := checker.Check(strings.NewReader(input), &out)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	want := "file.go:2:first\nother.go:1:first\n"
+	if have := out.String(); have != want {
+		t.Errorf("unexpected output:\nhave: %q\nwant: %q", have, want)
+	}
+	if len(issues) != 2 {
+		t.Errorf("unexpected issues: %v", issues)
+	}
+}
+
+func TestCheckerStrictNewFiles(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,1 +1,1 @@
+-func Line() {}
++func NewLine() {}
+--- /dev/null
++++ b/created.go
+@@ -0,0 +1,1 @@
++package main`)
+
+	check := func(input string) []Issue {
+		checker := Checker{
+			Patch:    bytes.NewReader(diff),
+			NewFiles: []string{"new.go"},
+		}
+		issues, err := checker.Check(strings.NewReader(input), ioutil.Discard)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return issues
+	}
+
+	modified := check("file.go:1:issue\n")
+	if len(modified) != 1 || modified[0].NewFile {
+		t.Fatalf("unexpected issues in modified file: %#v", modified)
+	}
+	added := check("new.go:1:issue\n")
+	if len(added) != 1 || !added[0].NewFile {
+		t.Fatalf("unexpected issues in new file: %#v", added)
+	}
+	if created := check("created.go:1:issue\n"); len(created) != 1 || !created[0].NewFile {
+		t.Fatalf("unexpected issues in file created by patch: %#v", created)
+	}
+
+	tests := []struct {
+		issues         []Issue
+		warnOnly       bool
+		strictNewFiles bool
+		want           bool
+	}{
+		{nil, false, false, false},
+		{modified, false, false, true},
+		{modified, true, false, false},
+		{modified, true, true, false},
+		{added, false, false, true},
+		{added, true, false, false},
+		{added, true, true, true},
+	}
+
+	for i, test := range tests {
+		checker := Checker{StrictNewFiles: test.strictNewFiles}
+		if have := checker.ShouldFail(test.issues, test.warnOnly); have != test.want {
+			t.Errorf("test %d: unexpected ShouldFail: have %v want %v", i, have, test.want)
+		}
+	}
+}
+
+func TestCheckerHunkPosMode(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -10,2 +10,3 @@
+ func Line() {}
+-func OldLine() {}
++func NewLine() {}
++func OtherLine() {}`)
+
+	tests := []struct {
+		mode  string
+		file  int
+		newly int
+	}{
+		{"", 4, 7},
+		{HunkPosPosition, 4, 7},
+		{HunkPosLine, 12, 7},
+		{HunkPosChanged, 3, 7},
+	}
+
+	for _, test := range tests {
+		checker := Checker{
+			Patch:       bytes.NewReader(diff),
+			NewFiles:    []string{"new.go"},
+			HunkPosMode: test.mode,
+		}
+		issues, err := checker.Check(strings.NewReader("file.go:12:issue\nnew.go:7:issue\n"), ioutil.Discard)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", test.mode, err)
+		}
+		want := []Issue{
+			{File: "file.go", LineNo: 12, HunkPos: test.file, Issue: "file.go:12:issue", Message: "issue"},
+			{File: "new.go", LineNo: 7, HunkPos: test.newly, Issue: "new.go:7:issue", Message: "issue", NewFile: true},
+		}
+		if !reflect.DeepEqual(issues, want) {
+			t.Errorf("%q: unexpected issues:\nhave: %#v\nwant: %#v", test.mode, issues, want)
+		}
+	}
+
+	checker := Checker{Patch: bytes.NewReader(diff), HunkPosMode: "unknown"}
+	if _, err := checker.Check(strings.NewReader(""), ioutil.Discard); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestCheckerNoNewlineMarker(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,2 +1,3 @@
+ func Line() {}
+-func OldLine() {}
+\ No newline at end of file
++func NewLine() {}
++func OtherLine() {}
+--- a/other.go
++++ b/other.go
+@@ -1,1 +1,2 @@
+ func Line() {}
++func NewLine() {}
+\ No newline at end of file`)
+
+	tests := []struct {
+		mode string
+		want []int
+	}{
+		{HunkPosPosition, []int{4, 5, 2}},
+		{HunkPosChanged, []int{2, 3, 1}},
+	}
+
+	for _, test := range tests {
+		checker := Checker{
+			Patch:       bytes.NewReader(diff),
+			HunkPosMode: test.mode,
+		}
+		issues, err := checker.Check(strings.NewReader("file.go:2: a\nfile.go:3: b\nfile.go:4: not in file\nother.go:2: c\n"), ioutil.Discard)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", test.mode, err)
+		}
+		var have []int
+		for _, issue := range issues {
+			have = append(have, issue.HunkPos)
+		}
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("%q: unexpected hunk positions: have %v want %v", test.mode, have, test.want)
+		}
+	}
+}
+
+func TestCheckerDotSlashPaths(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,1 +1,1 @@
+-func Line() {}
++func NewLine() {}`)
+
+	checker := Checker{Patch: bytes.NewReader(diff)}
+
+	var out bytes.Buffer
+	issues, err := checker.Check(strings.NewReader("./file.go:1:issue\n./file.go:2:unchanged\n"), &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []Issue{{File: "file.go", LineNo: 1, HunkPos: 2, Issue: "./file.go:1:issue", Message: "issue"}}
+	if !reflect.DeepEqual(issues, want) {
+		t.Errorf("unexpected issues:\nhave: %#v\nwant: %#v", issues, want)
+	}
+	if have, want := out.String(), "./file.go:1:issue\n"; have != want {
+		t.Errorf("unexpected output: have %q want %q", have, want)
+	}
+}
+
+func TestCheckerURLDecodePaths(t *testing.T) {
+	diff := []byte(`--- a/my file.go
++++ b/my file.go
+@@ -1,1 +1,1 @@
+-func Line() {}
++func NewLine() {}`)
+	input := "my%20file.go:1:issue\nmy%zzfile.go:1:invalid encoding\n"
+
+	checker := Checker{Patch: bytes.NewReader(diff)}
+	issues, err := checker.Check(strings.NewReader(input), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(issues) != 0 {
+		t.Errorf("unexpected issues without URLDecodePaths: %#v", issues)
+	}
+
+	checker = Checker{Patch: bytes.NewReader(diff), URLDecodePaths: true}
+	issues, err = checker.Check(strings.NewReader(input), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Issue{{File: "my file.go", LineNo: 1, HunkPos: 2, Issue: "my%20file.go:1:issue", Message: "issue"}}
+	if !reflect.DeepEqual(issues, want) {
+		t.Errorf("unexpected issues:\nhave: %#v\nwant: %#v", issues, want)
+	}
+}
+
+func TestCheckerHunkHeatmap(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,2 +1,3 @@
+ func Line() {}
++func NewLine() {}
++func OtherLine() {}
+@@ -20,1 +21,2 @@
+ func Line() {}
++func NewLine() {}`)
+
+	checker := Checker{
+		Patch:    bytes.NewReader(diff),
+		NewFiles: []string{"new.go"},
+	}
+	issues := []Issue{
+		{File: "file.go", LineNo: 2},
+		{File: "file.go", LineNo: 3},
+		{File: "file.go", LineNo: 3},
+		{File: "file.go", LineNo: 22},
+		{File: "file.go", LineNo: 10}, // unchanged
+		{File: "new.go", LineNo: 5},
+		{File: "new.go", LineNo: 50},
+		{File: "other.go", LineNo: 1}, // not in patch
+	}
+
+	want := map[string]map[int]int{
+		"file.go": {1: 3, 21: 1},
+		"new.go":  {1: 2},
+	}
+	have, err := checker.HunkHeatmap(issues)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected heatmap:\nhave: %v\nwant: %v", have, want)
+	}
+
+	checker = Checker{Patch: strings.NewReader("--- a/file.go\n+++ b/file.go\n@@ -1 +x @@\n+func NewLine() {}\n")}
+	if _, err := checker.HunkHeatmap(issues); err == nil {
+		t.Errorf("expected error for malformed patch")
+	}
+}
+
+func TestCheckerTrailingContext(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,6 +1,7 @@
+ func Line() {
+ 	one()
++	two()
+ 	three()
+ }
+ 
+ func Other() {}
+@@ -20,3 +21,2 @@
+ func Line() {
+-	one()
+ }`)
+
+	tests := []struct {
+		trailing int
+		want     []int
+	}{
+		{0, []int{3}},
+		{2, []int{3, 4, 5, 22}},
+		{10, []int{3, 4, 5, 6, 7, 22}},
+	}
+
+	for _, test := range tests {
+		checker := Checker{
+			Patch:           bytes.NewReader(diff),
+			TrailingContext: test.trailing,
+		}
+		var input string
+		for i := 1; i <= 22; i++ {
+			input += fmt.Sprintf("file.go:%d:issue\n", i)
+		}
+		issues, err := checker.Check(strings.NewReader(input), ioutil.Discard)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var have []int
+		for _, issue := range issues {
+			have = append(have, issue.LineNo)
+		}
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("trailing %d: unexpected lines: have %v want %v", test.trailing, have, test.want)
+		}
+	}
+}
+
+func TestCheckerIssueSink(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,1 +1,2 @@
+-func Line() {}
++func NewLine() {}
++func OtherLine() {}`)
+
+	var sunk []Issue
+	checker := Checker{
+		Patch:            bytes.NewReader(diff),
+		SortByPatchOrder: true,
+		PostFilters:      []func([]Issue) []Issue{func(issues []Issue) []Issue { return issues[1:] }},
+		IssueSink:        func(issue Issue) { sunk = append(sunk, issue) },
+	}
+	issues, err := checker.Check(strings.NewReader("file.go:2:second\nfile.go:5:unchanged\nfile.go:1:first\nfile.go:2:third\n"), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sunk) != 2 || !reflect.DeepEqual(sunk, issues) {
+		t.Errorf("unexpected sunk issues:\nhave: %#v\nwant: %#v", sunk, issues)
+	}
+}
+
+func TestCheckerPostFilters(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,1 +1,3 @@
+-func Line() {}
++func NewLine() {}
++func OtherLine() {}
++func LastLine() {}`)
+
+	reverse := func(issues []Issue) []Issue {
+		var reversed []Issue
+		for i := len(issues) - 1; i >= 0; i-- {
+			reversed = append(reversed, issues[i])
+		}
+		return reversed
+	}
+	first := func(issues []Issue) []Issue {
+		if len(issues) > 2 {
+			return issues[:2]
+		}
+		return issues
+	}
+
+	var out bytes.Buffer
+	checker := Checker{
+		Patch:       bytes.NewReader(diff),
+		PostFilters: []func([]Issue) []Issue{reverse, first},
+	}
+	issues, err := checker.Check(strings.NewReader("file.go:1:first\nfile.go:5:unchanged\nfile.go:2:second\nfile.go:3:third\n"), &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var have []string
+	for _, issue := range issues {
+		have = append(have, issue.Message)
+	}
+	if want := []string{"third", "second"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected issues: have %q want %q", have, want)
+	}
+	if want := "file.go:3:third\nfile.go:2:second\n"; out.String() != want {
+		t.Errorf("unexpected output:\nhave: %q\nwant: %q", out.String(), want)
+	}
+}
+
+func TestLinesChangedRename(t *testing.T) {
+	patch, err := ioutil.ReadFile(filepath.Join("testdata", "rename.patch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checker := Checker{Patch: bytes.NewReader(patch)}
+	have := checker.linesChanged()
+	want := map[string][]pos{
+		"new.go": []pos{{lineNo: 8, hunkPos: 4, hunkStart: 5}},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected pos:\nhave: %#v\nwant: %#v", have, want)
+	}
+
+	// pure rename, without content changes
+	checker = Checker{Patch: strings.NewReader("diff --git a/old.go b/new.go\nsimilarity index 100%\nrename from old.go\nrename to new.go\n")}
+	have = checker.linesChanged()
+	want = map[string][]pos{"new.go": []pos{}}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected pos:\nhave: %#v\nwant: %#v", have, want)
+	}
+
+	checker = Checker{Patch: bytes.NewReader(patch)}
+	issues, err := checker.Check(strings.NewReader("new.go:7:unchanged\nnew.go:8:unused\nold.go:8:unused\n"), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(issues) != 1 || issues[0].File != "new.go" || issues[0].LineNo != 8 {
+		t.Errorf("unexpected issues: %#v", issues)
+	}
+}
+
+func TestLinesChangedOverlappingHunks(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,2 +1,3 @@
+ func Line() {}
++func NewLine() {}
+ func Line2() {}
+@@ -2,1 +3,2 @@
+ func Line2() {}
++func NewLine2() {}
+--- a/other.go
++++ b/other.go
+@@ -1,1 +1,2 @@
+ func Line() {}
++func NewLine() {}
+@@ -5,1 +6,2 @@
+ func Line() {}
++func NewLine() {}`)
+
+	var debug bytes.Buffer
+	checker := Checker{Patch: bytes.NewReader(diff), Debug: &debug}
+	have := checker.linesChanged()
+	want := map[string][]pos{
+		"file.go": []pos{
+			{lineNo: 2, hunkPos: 2, hunkStart: 1},
+			{lineNo: 4, hunkPos: 6, hunkStart: 3},
+		},
+		"other.go": []pos{
+			{lineNo: 2, hunkPos: 2, hunkStart: 1},
+			{lineNo: 7, hunkPos: 5, hunkStart: 6},
+		},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected pos:\nhave: %#v\nwant: %#v", have, want)
+	}
+
+	const warning = "overlaps lines"
+	if n := strings.Count(debug.String(), warning); n != 1 {
+		t.Errorf("expected 1 warning %q in debug output, have %d:\n%s", warning, n, debug.String())
+	}
+	if want := `hunk "@@ -2,1 +3,2 @@" in "file.go" overlaps lines 3 to 3`; !strings.Contains(debug.String(), want) {
+		t.Errorf("expected warning %q in debug output:\n%s", want, debug.String())
+	}
+}
+
+func TestLinesChangedMergeHunkGap(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,4 +1,5 @@
+ func Line1() {}
++func NewLine2() {}
+ func Line2() {}
+ func Line3() {}
+ func Line4() {}
+@@ -8,3 +9,4 @@
+ func Line8() {}
+ func Line9() {}
++func NewLine11() {}
+ func Line10() {}`)
+
+	tests := []struct {
+		gap  int
+		want []pos
+	}{
+		{0, []pos{
+			{lineNo: 2, hunkPos: 2, hunkStart: 1},
+			{lineNo: 11, hunkPos: 9, hunkStart: 9},
+		}},
+		{2, []pos{
+			{lineNo: 2, hunkPos: 2, hunkStart: 1},
+			{lineNo: 11, hunkPos: 9, hunkStart: 9},
+		}},
+		{3, []pos{
+			{lineNo: 2, hunkPos: 2, hunkStart: 1},
+			{lineNo: 3, hunkPos: 9, hunkStart: 1, unchanged: true},
+			{lineNo: 4, hunkPos: 9, hunkStart: 1, unchanged: true},
+			{lineNo: 5, hunkPos: 9, hunkStart: 1, unchanged: true},
+			{lineNo: 6, hunkPos: 9, hunkStart: 1, unchanged: true},
+			{lineNo: 7, hunkPos: 9, hunkStart: 1, unchanged: true},
+			{lineNo: 8, hunkPos: 9, hunkStart: 1, unchanged: true},
+			{lineNo: 9, hunkPos: 9, hunkStart: 1, unchanged: true},
+			{lineNo: 10, hunkPos: 9, hunkStart: 1, unchanged: true},
+			{lineNo: 11, hunkPos: 9, hunkStart: 1},
+		}},
+	}
+
+	for _, test := range tests {
+		checker := Checker{Patch: bytes.NewReader(diff), MergeHunkGap: test.gap}
+		have := checker.linesChanged()
+		if want := map[string][]pos{"file.go": test.want}; !reflect.DeepEqual(have, want) {
+			t.Errorf("gap %d: unexpected pos:\nhave: %#v\nwant: %#v", test.gap, have, want)
+		}
+	}
+}
+
+func TestLinesChangedMarkers(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,3 +1,3 @@
+ func Line() {}
+< func OldLine() {}
+> func NewLine() {}
+ func OtherLine() {}
++func NotAdded() {}`)
+
+	var contents []string
+	checker := Checker{
+		Patch:         bytes.NewReader(diff),
+		AddedMarker:   "> ",
+		RemovedMarker: "< ",
+		LineMatch: func(content string, issue Issue) bool {
+			contents = append(contents, content)
+			return true
+		},
+	}
+	issues, err := checker.Check(strings.NewReader("file.go:1: context\nfile.go:2: added\nfile.go:3: context\n"), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(issues) != 1 || issues[0].LineNo != 2 || issues[0].HunkPos != 3 {
+		t.Errorf("unexpected issues: %#v", issues)
+	}
+	if want := []string{"func NewLine() {}"}; !reflect.DeepEqual(contents, want) {
+		t.Errorf("unexpected added content: have %q want %q", contents, want)
+	}
+}
+
+func TestLinesChangedFileHeaderPattern(t *testing.T) {
+	diff := []byte(`Index: main.go
+===================================================================
+--- main.go	(revision 1)
++++ main.go	(working copy)
+@@ -1,2 +1,3 @@
+ package main
++
+ func main() {}
+Index: subdir/other.go
+===================================================================
+--- subdir/other.go	(revision 1)
++++ subdir/other.go	(working copy)
+@@ -3,1 +3,1 @@
+-func Line() {}
++func NewLine() {}`)
+
+	checker := Checker{
+		Patch:             bytes.NewReader(diff),
+		FileHeaderPattern: `^Index: (.*)$`,
+	}
+	have := checker.linesChanged()
+	want := map[string][]pos{
+		"main.go":         []pos{{lineNo: 2, hunkPos: 2, hunkStart: 1}},
+		"subdir/other.go": []pos{{lineNo: 3, hunkPos: 2, hunkStart: 3}},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected pos:\nhave: %#v\nwant: %#v", have, want)
+	}
+
+	for _, pattern := range []string{`^Index: .*$`, `^Index: (.*$`} {
+		checker := Checker{Patch: bytes.NewReader(diff), FileHeaderPattern: pattern}
+		if _, err := checker.Check(strings.NewReader(""), ioutil.Discard); err == nil {
+			t.Errorf("%q: expected error", pattern)
+		}
+	}
+}
+
+func TestCheckerStrictColumnParse(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,1 +1,1 @@
+-func Line() {}
++func NewLine() {}`)
+
+	tests := []struct {
+		strict bool
+		want   []Issue
+	}{
+		{false, []Issue{
+			{File: "file.go", LineNo: 1, ColNo: 5, HunkPos: 2, Issue: "file.go:1:5:ok", Message: "ok"},
+			{File: "file.go", LineNo: 1, HunkPos: 2, Issue: "file.go:1:x5:malformed", Message: "malformed"},
+		}},
+		{true, []Issue{
+			{File: "file.go", LineNo: 1, ColNo: 5, HunkPos: 2, Issue: "file.go:1:5:ok", Message: "ok"},
+		}},
+	}
+
+	for _, test := range tests {
+		checker := Checker{
+			Patch:             bytes.NewReader(diff),
+			Regexp:            `(.*?\.go):([0-9]+):([^:]*):(.*)`,
+			StrictColumnParse: test.strict,
+		}
+		issues, err := checker.Check(strings.NewReader("file.go:1:5:ok\nfile.go:1:x5:malformed\n"), ioutil.Discard)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(issues, test.want) {
+			t.Errorf("strict %v: unexpected issues:\nhave: %#v\nwant: %#v", test.strict, issues, test.want)
+		}
+	}
+}
+
+func TestCheckerSplitMultiOnLine(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,1 +1,2 @@
+-func Line() {}
++func NewLine() {}
++func OtherLine() {}`)
+
+	input := "file.go:1: first; file.go:2:3: second\nfile.go:2: expected ';', found newline\nfile.go:1: a | file.go:2: b\n"
+	tests := []struct {
+		split bool
+		sep   string
+		want  []string
+	}{
+		{false, "", []string{"first; file.go:2:3: second", "expected ';', found newline", "a | file.go:2: b"}},
+		{true, "", []string{"first", "second", "expected ';', found newline", "a | file.go:2: b"}},
+		{true, "|", []string{"first; file.go:2:3: second", "expected ';', found newline", "a", "b"}},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		checker := Checker{
+			Patch:                bytes.NewReader(diff),
+			SplitMultiOnLine:     test.split,
+			MultiOnLineSeparator: test.sep,
+		}
+		issues, err := checker.Check(strings.NewReader(input), &out)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var have []string
+		for _, issue := range issues {
+			have = append(have, issue.Message)
+		}
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("split %v sep %q: unexpected messages:\nhave: %q\nwant: %q", test.split, test.sep, have, test.want)
+		}
+	}
+}
+
+func TestCheckerPatchOffsets(t *testing.T) {
+	diff := []byte(`diff --git a/file.go b/file.go
+--- a/file.go
++++ b/file.go
+@@ -1,2 +1,2 @@
+-func Line() {}
++func NewLine() {}
+ func Line2() {}
+@@ -10,1 +10,2 @@
+ func Line10() {}
++func NewLine11() {}
+diff --git a/other.go b/other.go
+--- a/other.go
++++ b/other.go
+@@ -1,1 +1,2 @@
+ func Line() {}
++func NewLine() {}`)
+
+	checker := Checker{
+		Patch:        bytes.NewReader(diff),
+		NewFiles:     []string{"new.go"},
+		PatchOffsets: true,
+	}
+	issues, err := checker.Check(strings.NewReader("file.go:1: a\nfile.go:11: b\nother.go:2: c\nnew.go:3: d\n"), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var have []int
+	for _, issue := range issues {
+		have = append(have, issue.PatchOffset)
+	}
+	if want := []int{6, 10, 16, 0}; !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected patch offsets: have %v want %v", have, want)
+	}
+}
+
+func TestCheckerSortByPatchOrder(t *testing.T) {
+	diff := []byte(`diff --git a/file.go b/file.go
+--- a/file.go
++++ b/file.go
+@@ -1,2 +1,2 @@
+-func Line() {}
++func NewLine() {}
+ func Line2() {}
+@@ -10,1 +10,2 @@
+ func Line10() {}
++func NewLine11() {}
+diff --git a/other.go b/other.go
+--- a/other.go
++++ b/other.go
+@@ -1,1 +1,2 @@
+ func Line() {}
++func NewLine() {}`)
+	input := "new.go:3: new\nother.go:2: other\nfile.go:11: second hunk\nb.go:1: new b\nfile.go:1: first hunk\nfile.go:11: second hunk again\n"
+
+	checker := Checker{
+		Patch:            bytes.NewReader(diff),
+		NewFiles:         []string{"new.go", "b.go"},
+		SortByPatchOrder: true,
+	}
+	var out bytes.Buffer
+	issues, err := checker.Check(strings.NewReader(input), &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var have []string
+	for _, issue := range issues {
+		have = append(have, issue.Message)
+		if issue.PatchOffset != 0 {
+			t.Errorf("unexpected patch offset without PatchOffsets: %#v", issue)
+		}
+	}
+	want := []string{"first hunk", "second hunk", "second hunk again", "other", "new b", "new"}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected order:\nhave: %q\nwant: %q", have, want)
+	}
+	if want := "file.go:1: first hunk\nfile.go:11: second hunk\nfile.go:11: second hunk again\nother.go:2: other\nb.go:1: new b\nnew.go:3: new\n"; out.String() != want {
+		t.Errorf("unexpected output:\nhave: %q\nwant: %q", out.String(), want)
+	}
+}
+
+func TestCheckerMaxInputLines(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,1 +1,2 @@
+-func Line() {}
++func NewLine() {}
++func OtherLine() {}`)
+
+	tests := []struct {
+		max     int
+		want    int
+		wantErr bool
+	}{
+		{0, 3, false},
+		{4, 3, false},
+		{3, 2, true},
+	}
+
+	for _, test := range tests {
+		checker := Checker{
+			Patch:         bytes.NewReader(diff),
+			MaxInputLines: test.max,
+		}
+		issues, err := checker.Check(strings.NewReader("file.go:1: a\nfile.go:5: unchanged\nfile.go:2: b\nfile.go:1: c\n"), ioutil.Discard)
+		if (err != nil) != test.wantErr {
+			t.Errorf("max %d: unexpected error: %v", test.max, err)
+		}
+		if len(issues) != test.want {
+			t.Errorf("max %d: unexpected issues: have %d want %d", test.max, len(issues), test.want)
+		}
+	}
+}
+
+func TestCheckerRequireLinterSawAllFiles(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,1 +1,2 @@
+ func Line() {}
++func NewLine() {}
+--- a/skipped.go
++++ b/skipped.go
+@@ -1,1 +1,2 @@
+ func Line() {}
++func NewLine() {}
+--- a/README.md
++++ b/README.md
+@@ -1,1 +1,2 @@
+ # Readme
++Changed`)
+
+	tests := []struct {
+		newFiles []string
+		input    string
+		want     string
+	}{
+		{nil, "file.go:1: ok\nskipped.go:1: ok\n", ""},
+		{[]string{"new.go"}, "file.go:1: ok\nskipped.go:1: ok\n", "tool's output didn't name changed files: new.go"},
+		{[]string{"new.go"}, "file.go:2: changed\n", "tool's output didn't name changed files: new.go, skipped.go"},
+		{nil, "", "tool's output didn't name changed files: file.go, skipped.go"},
+	}
+
+	for _, test := range tests {
+		checker := Checker{
+			Patch:                    bytes.NewReader(diff),
+			NewFiles:                 test.newFiles,
+			RequireLinterSawAllFiles: true,
+		}
+		_, err := checker.Check(strings.NewReader(test.input), ioutil.Discard)
+		var have string
+		if err != nil {
+			have = err.Error()
+		}
+		if have != test.want {
+			t.Errorf("%q: unexpected error: have %q want %q", test.input, have, test.want)
+		}
+	}
+}
+
+func TestCheckerTolerantNumbers(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1233,1 +1233,2 @@
+ func Line() {}
++func NewLine() {}`)
+
+	tests := []struct {
+		tolerant bool
+		want     []Issue
+	}{
+		{false, nil},
+		{true, []Issue{
+			{File: "file.go", LineNo: 1234, ColNo: 1000, HunkPos: 2, Issue: "file.go:1_234:1,000:underscore", Message: "underscore"},
+			{File: "file.go", LineNo: 1234, HunkPos: 2, Issue: "file.go:1,234:comma", Message: "comma"},
+		}},
+	}
+
+	for _, test := range tests {
+		checker := Checker{
+			Patch:           bytes.NewReader(diff),
+			Regexp:          `(.*?\.go):([0-9_,]+):(?:([0-9_,]+):)?(.*)`,
+			TolerantNumbers: test.tolerant,
+		}
+		issues, err := checker.Check(strings.NewReader("file.go:1_234:1,000:underscore\nfile.go:1,234:comma\n"), ioutil.Discard)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(issues, test.want) {
+			t.Errorf("tolerant %v: unexpected issues:\nhave: %#v\nwant: %#v", test.tolerant, issues, test.want)
+		}
+	}
+
+	// without Regexp, the default pattern captures the separators
+	checker := Checker{Patch: bytes.NewReader(diff), TolerantNumbers: true}
+	issues, err := checker.Check(strings.NewReader("file.go:1_234:1,000: underscore\nfile.go:1,234: comma\n"), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(issues) != 2 || issues[0].ColNo != 1000 || issues[1].LineNo != 1234 {
+		t.Errorf("default pattern: unexpected issues: %#v", issues)
+	}
+}
+
+func TestCheckerValidate(t *testing.T) {
+	var debug bytes.Buffer
+	checker := Checker{
+		Patch:        bytes.NewReader(nil),
+		RevisionFrom: "HEAD~1",
+		Debug:        &debug,
+	}
+	if err := checker.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if want := `warning: revisions "HEAD~1" and "" are ignored as Patch is set`; !strings.Contains(debug.String(), want) {
+		t.Errorf("expected warning %q in debug output:\n%s", want, debug.String())
+	}
+
+	checker.StrictValidation = true
+	if _, err := checker.Check(strings.NewReader(""), ioutil.Discard); err == nil {
+		t.Error("expected error with StrictValidation")
+	}
+
+	checker = Checker{Patch: bytes.NewReader(nil), Format: "xml"}
+	if err := checker.Validate(); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestCheckPatchError(t *testing.T) {
+	// a line longer than bufio.MaxScanTokenSize can't be read
+	diff := "--- a/file.go\n+++ b/file.go\n@@ -1,1 +1,1 @@\n-func Line() {}\n+func NewLine() {}\n--- a/other.go\n+++ b/other.go\n@@ -1,1 +1,1 @@\n+" + strings.Repeat("x", bufio.MaxScanTokenSize) + "\n"
+
+	checker := Checker{Patch: strings.NewReader(diff)}
+	issues, err := checker.Check(strings.NewReader("file.go:1:issue\n"), ioutil.Discard)
+	if err == nil || !strings.Contains(err.Error(), "error reading patch") {
+		t.Errorf("expected error reading patch, got: %v", err)
+	}
+	if len(issues) != 1 {
+		t.Errorf("expected issues read before the error, got: %#v", issues)
+	}
+}
+
+func TestCheckerChangedFilesList(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checker := Checker{
+		ChangedFilesList: []string{"changed.go", filepath.Join(wd, "subdir", "other.go")},
+		RevisionFrom:     "not-a-revision", // VCS isn't used
+	}
+	input := "changed.go:1:issue\nsubdir/other.go:20:issue\nunchanged.go:1:issue\n"
+	issues, err := checker.Check(strings.NewReader(input), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []Issue{
+		{File: "changed.go", LineNo: 1, HunkPos: 1, Issue: "changed.go:1:issue", Message: "issue"},
+		{File: "subdir/other.go", LineNo: 20, HunkPos: 20, Issue: "subdir/other.go:20:issue", Message: "issue"},
+	}
+	if !reflect.DeepEqual(issues, want) {
+		t.Errorf("unexpected issues:\nhave: %#v\nwant: %#v", issues, want)
+	}
+}
+
+func TestCheckerSeverityMap(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,1 +1,1 @@
+-func Line() {}
++func NewLine() {}`)
+
+	checker := Checker{
+		Patch:       bytes.NewReader(diff),
+		Regexp:      `(?P<file>.*?\.go):(?P<line>[0-9]+): (?P<severity>\w+): (?P<message>.*)`,
+		SeverityMap: map[string]string{"blocker": "error", "high": "error", "minor": "info"},
+	}
+	input := "file.go:1: blocker: first\nfile.go:1: BLOCKER: second\nfile.go:1: minor: third\nfile.go:1: warning: fourth\n"
+	issues, err := checker.Check(strings.NewReader(input), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var have []string
+	for _, issue := range issues {
+		have = append(have, issue.Severity)
+	}
+	if want := []string{"error", "error", "info", "warning"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected severities: have %q want %q", have, want)
+	}
+}
+
+func TestCheckerChangedLineCount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "revgrep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "new.go"), []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,2 +1,3 @@
+ func Line() {}
+-func OldLine() {}
++func NewLine() {}
++func OtherLine() {}
+--- a/other.go
++++ b/other.go
+@@ -10,1 +10,1 @@
+-func Line() {}
++func NewLine() {}`)
+
+	checker := Checker{
+		Patch:           bytes.NewReader(diff),
+		NewFiles:        []string{"new.go"},
+		AbsPath:         dir,
+		IncludeDeleted:  true,
+		TrailingContext: 1,
+	}
+	count, err := checker.ChangedLineCount()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := 6; count != want {
+		t.Errorf("unexpected count: have %d want %d", count, want)
+	}
+}
+
+func TestCheckerSummary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "revgrep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "new.go"), []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,2 +1,3 @@
+ func Line() {}
+-func OldLine() {}
++func NewLine() {}
++func OtherLine() {}
+--- a/deleted.go
++++ /dev/null
+@@ -1,1 +0,0 @@
+-func Line() {}`)
+
+	var summary Summary
+	checker := Checker{
+		Patch:    bytes.NewReader(diff),
+		NewFiles: []string{"new.go"},
+		AbsPath:  dir,
+		Regexp:   `^(?P<file>.*?):(?P<line>[0-9]+): (?P<severity>[a-z]+): (?P<message>.*)`,
+		Summary:  &summary,
+	}
+	input := "file.go:2: error: first\nfile.go:3: warning: second\nfile.go:1: error: unchanged\nnew.go:1: error: new\n"
+	if _, err := checker.Check(strings.NewReader(input), ioutil.Discard); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Summary{
+		FilesChanged:     2,
+		LinesChanged:     5,
+		Issues:           3,
+		IssuesBySeverity: map[string]int{"error": 2, "warning": 1},
+	}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("unexpected summary:\nhave: %#v\nwant: %#v", summary, want)
+	}
+
+	// input is read even if empty
+	checker.Patch = bytes.NewReader(diff)
+	if _, err := checker.Check(strings.NewReader(""), ioutil.Discard); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = Summary{FilesChanged: 2, LinesChanged: 5}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("unexpected summary:\nhave: %#v\nwant: %#v", summary, want)
+	}
+}
+
+func TestCheckerEmptyFile(t *testing.T) {
+	checker := Checker{
+		Patch:  bytes.NewReader(nil),
+		Regexp: `^(.*?):([0-9]+): (.*)`,
+	}
+	issues, err := checker.Check(strings.NewReader(":1: empty file\n"), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(issues) != 0 {
+		t.Errorf("unexpected issues: %#v", issues)
+	}
+}
+
+func TestCheckerMatchLeadingContext(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,5 +1,6 @@
+ func Line() {
+ 	one()
++	two()
+ 	three()
+-	four()
++	five()
+ }
+@@ -20,2 +21,1 @@
+ func Other() {}
+-func Removed() {}`)
+
+	tests := []struct {
+		leading bool
+		want    []int
+	}{
+		{false, []int{3, 5}},
+		{true, []int{2, 3, 5, 21}},
+	}
+
+	for _, test := range tests {
+		checker := Checker{
+			Patch:               bytes.NewReader(diff),
+			MatchLeadingContext: test.leading,
+		}
+		var input string
+		for i := 1; i <= 22; i++ {
+			input += fmt.Sprintf("file.go:%d:issue\n", i)
+		}
+		issues, err := checker.Check(strings.NewReader(input), ioutil.Discard)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var have []int
+		for _, issue := range issues {
+			have = append(have, issue.LineNo)
+		}
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("leading %v: unexpected lines: have %v want %v", test.leading, have, test.want)
+		}
+	}
+}
+
+func TestCheckerWithPatch(t *testing.T) {
+	prevwd, sample := setup(t, "6-unstaged", "")
+	defer teardown(t, prevwd)
+
+	checker, err := Checker{}.WithPatch()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if checker.Patch == nil {
+		t.Fatal("expected patch to be read")
+	}
+	patch, err := ioutil.ReadAll(checker.Patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// changes made after the patch was read aren't checked
+	if err := ioutil.WriteFile("main.go", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	checker.Patch = bytes.NewReader(patch)
+	issues, err := checker.Check(bytes.NewReader(sample), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(issues) != 1 || issues[0].LineNo != 6 {
+		t.Errorf("unexpected issues: %#v", issues)
+	}
+}
+
+func TestCheckerChangedFiles(t *testing.T) {
+	diff := []byte(`--- a/file.go
++++ b/file.go
+@@ -1,1 +1,1 @@
+-func Line() {}
++func NewLine() {}
+--- a/deleted.go
++++ /dev/null
+@@ -1,1 +0,0 @@
+-package main
+--- a/README.md
++++ b/README.md
+@@ -1,1 +1,1 @@
+-old
++new
+`)
+	checker := Checker{
+		Patch:    bytes.NewReader(diff),
+		NewFiles: []string{"new.go"},
+	}
+	files, err := checker.ChangedFiles()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"README.md", "file.go", "new.go"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("unexpected files: have %q want %q", files, want)
+	}
+}
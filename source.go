@@ -0,0 +1,302 @@
+package revgrep
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// stableKeyContext is the number of lines before and after an issue included
+// in its stable key.
+const stableKeyContext = 2
+
+// sources caches the contents of source files read from disk.
+type sources struct {
+	lines map[string][]string
+	errs  map[string]error
+
+	starts    map[string][]int // offsets of the start of each line, see offsetPosition
+	startErrs map[string]error
+
+	fset      *token.FileSet
+	files     map[string]*ast.File // parsed Go files, see symbol
+	parseErrs map[string]error
+}
+
+func newSources() *sources {
+	return &sources{
+		lines:     make(map[string][]string),
+		errs:      make(map[string]error),
+		starts:    make(map[string][]int),
+		startErrs: make(map[string]error),
+		fset:      token.NewFileSet(),
+		files:     make(map[string]*ast.File),
+		parseErrs: make(map[string]error),
+	}
+}
+
+// fileLines returns the lines of the file at path.
+func (s *sources) fileLines(path string) ([]string, error) {
+	if err, ok := s.errs[path]; ok {
+		return nil, err
+	}
+	if lines, ok := s.lines[path]; ok {
+		return lines, nil
+	}
+
+	lines, err := readLines(path)
+	if err != nil {
+		s.errs[path] = err
+		return nil, err
+	}
+	s.lines[path] = lines
+	return lines, nil
+}
+
+// offsetPosition returns the line and column number, both counting from 1, of
+// the byte offset, counting from 0, in the file at path. An offset at the end
+// of the file is after its last byte.
+func (s *sources) offsetPosition(path string, offset int) (line, col int, err error) {
+	if err, ok := s.startErrs[path]; ok {
+		return 0, 0, err
+	}
+	starts, ok := s.starts[path]
+	if !ok {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			s.startErrs[path] = err
+			return 0, 0, err
+		}
+		starts = []int{0}
+		for i, b := range src {
+			if b == '\n' {
+				starts = append(starts, i+1)
+			}
+		}
+		// the end of the file, which is the start of a line only if the
+		// file doesn't end with a newline
+		starts = append(starts, len(src))
+		s.starts[path] = starts
+	}
+
+	size := starts[len(starts)-1]
+	if offset > size {
+		return 0, 0, fmt.Errorf("offset %d is beyond the end of the file, %d bytes", offset, size)
+	}
+	// the number of lines starting at or before offset, excluding the end
+	line = sort.Search(len(starts)-1, func(i int) bool { return starts[i] > offset })
+	return line, offset - starts[line-1] + 1, nil
+}
+
+// readLines returns the lines of the file at path.
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// stableKey returns a key for issue, the file at path, which is a hash of the
+// issue's file name, message, and the content of the lines surrounding the
+// issue, ignoring leading and trailing whitespace. The key doesn't change
+// when lines are added or removed elsewhere in the file.
+func (s *sources) stableKey(path string, issue Issue) (string, error) {
+	lines, err := s.fileLines(path)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha1.New()
+	io.WriteString(h, issue.File+"\x00"+issue.Message+"\x00")
+	for i := issue.LineNo - stableKeyContext; i <= issue.LineNo+stableKeyContext; i++ {
+		if i < 1 || i > len(lines) {
+			continue
+		}
+		io.WriteString(h, strings.TrimSpace(lines[i-1])+"\n")
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// goFile returns the parsed Go file at path. If the file has syntax errors,
+// such as when it's being edited, the declarations parsed before the errors
+// are returned with the error, and the file is nil only if it couldn't be
+// read.
+func (s *sources) goFile(path string) (*ast.File, error) {
+	if f, ok := s.files[path]; ok {
+		return f, s.parseErrs[path]
+	}
+
+	f, err := parser.ParseFile(s.fset, path, nil, 0)
+	s.files[path] = f
+	if err != nil {
+		s.parseErrs[path] = err
+	}
+	return f, err
+}
+
+// symbol returns the name of the top-level Go declaration enclosing line in
+// the Go file at path, see Issue.Symbol, or an empty string if there isn't
+// one. If the file has syntax errors, the symbol is resolved from the
+// declarations which could be parsed, and the error is also returned.
+func (s *sources) symbol(path string, line int) (string, error) {
+	f, err := s.goFile(path)
+	if f == nil {
+		return "", err
+	}
+	within := func(node ast.Node) bool {
+		return s.fset.Position(node.Pos()).Line <= line && line <= s.fset.Position(node.End()).Line
+	}
+
+	for _, decl := range f.Decls {
+		if !within(decl) {
+			continue
+		}
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil || len(decl.Recv.List) == 0 {
+				return decl.Name.Name, err
+			}
+			return receiverName(decl.Recv.List[0].Type) + "." + decl.Name.Name, err
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				if !within(spec) {
+					continue
+				}
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					return spec.Name.Name, err
+				case *ast.ValueSpec:
+					var names []string
+					for _, name := range spec.Names {
+						names = append(names, name.Name)
+					}
+					return strings.Join(names, ", "), err
+				}
+			}
+		}
+		return "", err
+	}
+	return "", err
+}
+
+// receiverName returns the name of a method's receiver type expr, without
+// any pointer or type parameters.
+func receiverName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(expr.X)
+	case *ast.IndexExpr:
+		return receiverName(expr.X)
+	case *ast.IndexListExpr:
+		return receiverName(expr.X)
+	case *ast.Ident:
+		return expr.Name
+	}
+	return ""
+}
+
+// statementChanges returns changes, with the lines of each multi-line
+// statement in the Go file, relative to AbsPath, with a changed line, see
+// StatementAware. If the file has syntax errors, only the statements which
+// could be parsed are used.
+func (c Checker) statementChanges(file string, changes []pos) []pos {
+	if len(changes) == 0 {
+		return changes
+	}
+	absPath, err := c.absPath()
+	if err != nil {
+		c.debugf("could not find statements in %q: %s", file, err)
+		return changes
+	}
+	src, err := ioutil.ReadFile(filepath.Join(absPath, file))
+	if err != nil {
+		c.debugf("could not find statements in %q: %s", file, err)
+		return changes
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, src, 0)
+	if err != nil {
+		c.debugf("could not find all statements in %q: %s", file, err)
+	}
+	if f == nil {
+		return changes
+	}
+
+	// deleted lines are numbered in the pre-image, so aren't in src
+	changed := make(map[int]pos)
+	for _, p := range changes {
+		if !p.deleted {
+			changed[p.lineNo] = p
+		}
+	}
+	lines := strings.Split(string(src), "\n")
+	line := func(p token.Pos) int { return fset.Position(p).Line }
+
+	ast.Inspect(f, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.AssignStmt, *ast.DeclStmt, *ast.DeferStmt, *ast.ExprStmt,
+			*ast.GoStmt, *ast.IncDecStmt, *ast.ReturnStmt, *ast.SendStmt:
+		default:
+			return true
+		}
+		start, end := line(node.Pos()), line(node.End())
+		if start == end {
+			return true
+		}
+
+		// lines within the bodies of function literals are their own
+		// statements
+		inner := make(map[int]bool)
+		ast.Inspect(node, func(node ast.Node) bool {
+			if lit, ok := node.(*ast.FuncLit); ok {
+				for l := line(lit.Body.Lbrace) + 1; l < line(lit.Body.Rbrace); l++ {
+					inner[l] = true
+				}
+				return false
+			}
+			return true
+		})
+
+		first, ok := pos{}, false
+		for l := start; l <= end && !ok; l++ {
+			first, ok = changed[l]
+			ok = ok && !inner[l]
+		}
+		if !ok {
+			return true
+		}
+		for l := start; l <= end; l++ {
+			if _, ok := changed[l]; ok || inner[l] {
+				continue
+			}
+			p := pos{lineNo: l, hunkPos: first.hunkPos, hunkStart: first.hunkStart, patchLine: first.patchLine, changedPos: first.changedPos, unchanged: true}
+			if c.LineMatch != nil && l <= len(lines) {
+				p.content = lines[l-1]
+			}
+			changed[l] = p
+			changes = append(changes, p)
+		}
+		return true
+	})
+
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].lineNo < changes[j].lineNo })
+	return changes
+}
@@ -0,0 +1,316 @@
+package revgrep
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckerStableKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "revgrep")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// keys returns the keys of issues found in src, changed at lineNo
+	keys := func(src string, lineNo int, input string) []string {
+		if err := ioutil.WriteFile(filepath.Join(dir, "file.go"), []byte(src), 0644); err != nil {
+			t.Fatalf("could not write file: %v", err)
+		}
+		diff := fmt.Sprintf("--- a/file.go\n+++ b/file.go\n@@ -%d,0 +%d,1 @@\n+%s\n",
+			lineNo, lineNo, strings.Split(src, "\n")[lineNo-1])
+
+		checker := Checker{
+			Patch:      strings.NewReader(diff),
+			AbsPath:    dir,
+			StableKeys: true,
+		}
+		issues, err := checker.Check(strings.NewReader(input), ioutil.Discard)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var keys []string
+		for _, issue := range issues {
+			if issue.Key == "" {
+				t.Errorf("issue has no key: %#v", issue)
+			}
+			keys = append(keys, issue.Key)
+		}
+		return keys
+	}
+
+	src := "package main\n\nfunc A() {}\nfunc B() {}\nfunc C() {}\nfunc D() {}\n"
+	before := keys(src, 5, "file.go:5:issue\nfile.go:5:other issue\n")
+
+	// simulate a rebase adding lines before the issue
+	src = "package main\n\n// rebased\n\nfunc A() {}\nfunc B() {}\nfunc C() {}\nfunc D() {}\n"
+	after := keys(src, 7, "file.go:7:issue\nfile.go:7:other issue\n")
+
+	if len(before) != 2 || len(after) != 2 {
+		t.Fatalf("unexpected number of keys: before %v after %v", before, after)
+	}
+	if before[0] != after[0] || before[1] != after[1] {
+		t.Errorf("keys changed after rebase: before %v after %v", before, after)
+	}
+	if before[0] == before[1] {
+		t.Errorf("issues with different messages have the same key: %v", before)
+	}
+}
+
+func TestCheckerResolveSymbols(t *testing.T) {
+	dir, err := ioutil.TempDir("", "revgrep")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := `package main
+
+import "fmt"
+
+var a, b = 1, 2
+
+type T struct {
+	F int
+}
+
+func (t *T) M() {
+	fmt.Println(t.F)
+}
+
+func main() {
+	func() {
+		fmt.Println(a, b)
+	}()
+}
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "file.go"), []byte(src), 0644); err != nil {
+		t.Fatalf("could not write file: %v", err)
+	}
+	lines := strings.Split(src, "\n")
+	diff := fmt.Sprintf("--- /dev/null\n+++ b/file.go\n@@ -0,0 +1,%d @@\n+%s\n",
+		len(lines)-1, strings.Join(lines[:len(lines)-1], "\n+"))
+
+	checker := Checker{
+		Patch:          strings.NewReader(diff),
+		AbsPath:        dir,
+		ResolveSymbols: true,
+	}
+	input := "file.go:1:package\nfile.go:3:import\nfile.go:5:var\nfile.go:8:type\nfile.go:12:method\nfile.go:17:closure\nfile.go:19:end\n"
+	issues, err := checker.Check(strings.NewReader(input), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]string{
+		"package": "",
+		"import":  "",
+		"var":     "a, b",
+		"type":    "T",
+		"method":  "T.M",
+		"closure": "main",
+		"end":     "main",
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("unexpected issues: %#v", issues)
+	}
+	for _, issue := range issues {
+		if have := issue.Symbol; have != want[issue.Message] {
+			t.Errorf("unexpected symbol for %s: have %q want %q", issue.Message, have, want[issue.Message])
+		}
+	}
+}
+
+func TestCheckerSourceErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "revgrep")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a file being edited, which doesn't parse after A
+	src := "package main\n\nfunc A() {\n}\n\nfunc B( {\n\tif x {\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "file.go"), []byte(src), 0644); err != nil {
+		t.Fatalf("could not write file: %v", err)
+	}
+	diff := "--- a/file.go\n+++ b/file.go\n@@ -3,0 +3,5 @@\n+func A() {\n+}\n+\n+func B( {\n+\tif x {\n" +
+		"--- a/missing.go\n+++ b/missing.go\n@@ -1,0 +1,1 @@\n+deleted since\n"
+
+	var debug bytes.Buffer
+	checker := Checker{
+		Patch:          strings.NewReader(diff),
+		AbsPath:        dir,
+		StableKeys:     true,
+		ResolveSymbols: true,
+		Debug:          &debug,
+	}
+	input := "file.go:3:in A\nfile.go:6:in B\nfile.go:7:after B\nmissing.go:1:missing file\n"
+	issues, err := checker.Check(strings.NewReader(input), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(issues) != 4 {
+		t.Fatalf("unexpected issues: %#v", issues)
+	}
+	if have, want := issues[0].Symbol, "A"; have != want {
+		t.Errorf("unexpected symbol before syntax error: have %q want %q", have, want)
+	}
+	for _, issue := range issues[:3] {
+		if issue.Key == "" {
+			t.Errorf("issue has no key: %#v", issue)
+		}
+	}
+	if issues[3].Key != "" || issues[3].Symbol != "" {
+		t.Errorf("unexpected key or symbol for missing file: %#v", issues[3])
+	}
+	if have := strings.Count(debug.String(), "could not resolve all symbols"); have != 1 {
+		t.Errorf("unexpected number of parse errors logged %d:\n%s", have, debug.String())
+	}
+}
+
+func TestCheckerStatementAware(t *testing.T) {
+	dir, err := ioutil.TempDir("", "revgrep")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := `package main
+
+func main() {
+	fmt.Printf("%s %s",
+		a,
+		b,
+	)
+	run(func() {
+		fmt.Println(
+			c,
+		)
+	})
+	if d {
+		return
+	}
+}
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "file.go"), []byte(src), 0644); err != nil {
+		t.Fatalf("could not write file: %v", err)
+	}
+	// only the argument a, and the call run, changed
+	diff := "--- a/file.go\n+++ b/file.go\n@@ -5,1 +5,1 @@\n-\t\tx,\n+\t\ta,\n@@ -8,1 +8,1 @@\n-\trun2(func() {\n+\trun(func() {\n"
+	input := "file.go:4:call\nfile.go:6:argument\nfile.go:10:literal\nfile.go:12:literal end\nfile.go:13:if\n"
+
+	check := func(statementAware bool) map[string]int {
+		checker := Checker{
+			Patch:          strings.NewReader(diff),
+			AbsPath:        dir,
+			StatementAware: statementAware,
+		}
+		issues, err := checker.Check(strings.NewReader(input), ioutil.Discard)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		hunkPos := make(map[string]int)
+		for _, issue := range issues {
+			hunkPos[issue.Message] = issue.HunkPos
+		}
+		return hunkPos
+	}
+
+	if have := check(false); len(have) != 0 {
+		t.Errorf("unexpected issues without StatementAware: %v", have)
+	}
+	want := map[string]int{"call": 2, "argument": 2, "literal end": 5}
+	if have := check(true); !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected issues: have %v want %v", have, want)
+	}
+}
+
+func TestCheckerStatementAwareDeleted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "revgrep")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := `package main
+
+func main() {
+	fmt.Printf("%s %s",
+		a,
+		b,
+	)
+	fmt.Println(
+		c,
+	)
+}
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "file.go"), []byte(src), 0644); err != nil {
+		t.Fatalf("could not write file: %v", err)
+	}
+	// the argument a changed, and the line deleted from the pre-image is
+	// numbered as the argument c
+	diff := "--- a/file.go\n+++ b/file.go\n@@ -5,1 +5,1 @@\n-\t\tx,\n+\t\ta,\n@@ -10,1 +9,0 @@\n-\t\tgone,\n"
+	checker := Checker{
+		Patch:          strings.NewReader(diff),
+		AbsPath:        dir,
+		StatementAware: true,
+		IncludeDeleted: true,
+		PatchOffsets:   true,
+	}
+	issues, err := checker.Check(strings.NewReader("file.go:6:argument\nfile.go:8:call\n"), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Issue{{File: "file.go", LineNo: 6, HunkPos: 2, PatchOffset: 5, Issue: "file.go:6:argument", Message: "argument"}}
+	if !reflect.DeepEqual(issues, want) {
+		t.Errorf("unexpected issues:\nhave: %#v\nwant: %#v", issues, want)
+	}
+}
+
+func TestCheckerByteOffsets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "revgrep")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// offsets of each line: 0, 14, 15, 29, 40, 42
+	src := "package main\r\n\nfunc main() {\n\tchanged()\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "file.go"), []byte(src), 0644); err != nil {
+		t.Fatalf("could not write file: %v", err)
+	}
+	diff := "--- a/file.go\n+++ b/file.go\n@@ -4,1 +4,1 @@\n-\told()\n+\tchanged()\n"
+
+	checker := Checker{
+		Patch:       strings.NewReader(diff),
+		AbsPath:     dir,
+		Tool:        "byte-offset",
+		ByteOffsets: true,
+	}
+	input := "file.go:@0: package\nfile.go:@29: line start\nfile.go:@30: changed\nfile.go:@39: line end\nfile.go:@40: next line\nfile.go:@1000: beyond end\nmissing.go:@29: missing file\n"
+	issues, err := checker.Check(strings.NewReader(input), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	type position struct{ line, col int }
+	have := make(map[string]position)
+	for _, issue := range issues {
+		have[issue.Message] = position{issue.LineNo, issue.ColNo}
+	}
+	want := map[string]position{
+		"line start": {4, 1},
+		"changed":    {4, 2},
+		"line end":   {4, 11},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected positions: have %v want %v", have, want)
+	}
+}
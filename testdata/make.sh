@@ -23,6 +23,20 @@ mkdir -p git/subdir && cd git
 git init > /dev/null
 git config --local user.name "testdata"
 git config --local user.email "testdata@example.com"
+
+# Staged files without any commits
+
+if [[ "$1" == "1-no-commits" ]]; then
+    cat > main.go <<EOF
+package main
+import "fmt"
+var _ = fmt.Sprintf("1-no-commits %s")
+func main() {}
+EOF
+    git add .
+    close
+fi
+
 touch readme
 git add .
 git commit -m "Initial commit" > /dev/null
@@ -127,3 +141,85 @@ EOF
     git commit -m "Commit" > /dev/null
     close
 fi
+
+# Two commits adding issues, where only the last commit should be checked
+
+if [[ "$1" == "13-last-commit" ]]; then
+    rm main2.go
+    git add .
+    git commit -m "Commit" > /dev/null
+
+    cat >> main.go <<EOF
+var _ = fmt.Sprintf("13-last-commit-first %s")
+EOF
+    cat >> subdir/main.go <<EOF
+var _ = fmt.Sprintf("13-last-commit-first-subdir %s")
+EOF
+
+    git add .
+    git commit -m "Commit" > /dev/null
+
+    cat >> main.go <<EOF
+var _ = fmt.Sprintf("13-last-commit-second %s")
+EOF
+
+    git add .
+    git commit -m "Commit" > /dev/null
+    close
+fi
+
+# Commits at different dates, and an unstaged change
+
+if [[ "$1" == "14-commit-dates" ]]; then
+    rm main2.go
+    git add .
+    git commit -m "Commit" > /dev/null
+
+    cat >> main.go <<EOF
+var _ = fmt.Sprintf("14-commit-dates-january %s")
+EOF
+
+    git add .
+    GIT_COMMITTER_DATE="2017-01-15T12:00:00Z" git commit -m "Commit" > /dev/null
+
+    cat >> main.go <<EOF
+var _ = fmt.Sprintf("14-commit-dates-june %s")
+EOF
+
+    git add .
+    GIT_COMMITTER_DATE="2017-06-15T12:00:00Z" git commit -m "Commit" > /dev/null
+
+    cat >> main.go <<EOF
+var _ = fmt.Sprintf("14-commit-dates-unstaged %s")
+EOF
+    close
+fi
+
+# A branch squash merged into trunk, which has since changed, and re-checked
+
+if [[ "$1" == "15-squash-merge" ]]; then
+    rm main2.go
+    git add .
+    git commit -m "Commit" > /dev/null
+    git checkout -q -b trunk
+    git checkout -q -b feature
+
+    cat >> main.go <<EOF
+var _ = fmt.Sprintf("15-squash-merge-feature %s")
+EOF
+
+    git add .
+    git commit -m "Feature" > /dev/null
+    git checkout -q trunk
+    git merge -q --squash feature > /dev/null
+    git commit -m "Squashed feature" > /dev/null
+
+    cat >> main.go <<EOF
+var _ = fmt.Sprintf("15-squash-merge-trunk %s")
+EOF
+
+    git add .
+    git commit -m "Commit" > /dev/null
+    git checkout -q feature
+    close
+fi
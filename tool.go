@@ -0,0 +1,149 @@
+package revgrep
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// DefaultTool is the name of the tool pattern used when neither Regexp nor
+// Tool is set, and no other pattern could be detected.
+const DefaultTool = "default"
+
+// autoDetectLines is the number of non-empty lines of input read to detect
+// which tool produced the output.
+const autoDetectLines = 10
+
+var (
+	toolMu sync.RWMutex
+	// toolPatterns maps tool names to regexps matching path, line number,
+	// optional column number, and message of each issue in the tool's output.
+	toolPatterns = map[string]*regexp.Regexp{
+		// file.go:lineNo:colNo:message
+		// colNo is optional, strip spaces before message
+		DefaultTool: regexp.MustCompile(`(.*?\.go):([0-9]+):([0-9]+)?:?\s*(.*)`),
+		// file.go:lineNo:colNo: message (linter)
+		"golangci-lint": regexp.MustCompile(`^(.*?\.go):([0-9]+):([0-9]+)?:?\s*(.*) \([a-z0-9_-]+\)$`),
+		// ./file.go:lineNo:colNo: message
+		"vet": regexp.MustCompile(`^\./(.*?\.go):([0-9]+):([0-9]+)?:?\s*(.*)`),
+		// file.go:lineNo.colNo: message
+		// the column is required, so it isn't detected for other output
+		"dot-column": regexp.MustCompile(`^(.*?\.go):([0-9]+)\.([0-9]+):?\s*(.*)`),
+		// file.go:@offset: message
+		// offset is a byte offset, see Checker.ByteOffsets, and the empty
+		// group is the column, found from the offset
+		"byte-offset": regexp.MustCompile(`^(.*?\.go):@([0-9]+)():?\s*(.*)`),
+	}
+)
+
+// RegisterToolPattern makes a pattern available by name to Checker.Tool and
+// AutoDetectFormat, replacing any pattern already registered with the same
+// name. The pattern's capture groups are the same as Checker.Regexp's, see
+// Checker.CompiledRegexp, and an error is returned if it's invalid or
+// doesn't capture the file and line.
+func RegisterToolPattern(name, pattern string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("could not parse pattern for %q: %v", name, err)
+	}
+	if _, ok := regexpFields(re)[FieldLine]; !ok {
+		return fmt.Errorf("pattern for %q must capture file and line", name)
+	}
+	toolMu.Lock()
+	defer toolMu.Unlock()
+	toolPatterns[name] = re
+	return nil
+}
+
+// toolPattern returns the pattern registered for the tool name.
+func toolPattern(name string) (*regexp.Regexp, bool) {
+	toolMu.RLock()
+	defer toolMu.RUnlock()
+	re, ok := toolPatterns[name]
+	return re, ok
+}
+
+// messageSeparator and numberGroup are the parts of a tool pattern rewritten
+// by preserveWhitespace and tolerantNumbers respectively.
+const (
+	messageSeparator = `:?\s*(.*)`
+	numberGroup      = `([0-9]+)`
+)
+
+// preserveWhitespace returns a variant of the tool pattern re which only
+// removes a single space before the message, see
+// Checker.PreserveMessageWhitespace. An error is returned if re doesn't
+// contain messageSeparator, as registered patterns may not.
+func preserveWhitespace(re *regexp.Regexp) (*regexp.Regexp, error) {
+	if !strings.Contains(re.String(), messageSeparator) {
+		return nil, fmt.Errorf("pattern %q doesn't match the message with %s", re, messageSeparator)
+	}
+	return regexp.MustCompile(strings.Replace(re.String(), messageSeparator, `:? ?(.*)`, 1)), nil
+}
+
+// tolerantNumbers returns a variant of the tool pattern re whose line and
+// column groups also match thousands separators, see Checker.TolerantNumbers.
+// An error is returned if re doesn't contain numberGroup, as registered
+// patterns may not.
+func tolerantNumbers(re *regexp.Regexp) (*regexp.Regexp, error) {
+	if !strings.Contains(re.String(), numberGroup) {
+		return nil, fmt.Errorf("pattern %q doesn't match numbers with %s", re, numberGroup)
+	}
+	return regexp.MustCompile(strings.Replace(re.String(), numberGroup, `([0-9_,]+)`, -1)), nil
+}
+
+// detectTool reads up to autoDetectLines non-empty lines from reader and
+// returns the name of the tool whose pattern, other than the default,
+// matched the most lines. If no pattern matched, or multiple patterns matched
+// the same number of lines, DefaultTool is returned.
+//
+// The returned reader reads the entire input, including any lines read.
+func detectTool(reader io.Reader) (string, io.Reader, error) {
+	var (
+		read     bytes.Buffer
+		br       = bufio.NewReader(reader)
+		hits     = make(map[string]int)
+		patterns = make(map[string]*regexp.Regexp)
+	)
+	// copy the patterns, so reading doesn't block RegisterToolPattern
+	toolMu.RLock()
+	for name, re := range toolPatterns {
+		if name != DefaultTool {
+			patterns[name] = re
+		}
+	}
+	toolMu.RUnlock()
+	for lines := 0; lines < autoDetectLines; {
+		line, err := br.ReadBytes('\n')
+		read.Write(line)
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			lines++
+			for name, re := range patterns {
+				if re.Match(line) {
+					hits[name]++
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	tool, most := DefaultTool, 0
+	for name, n := range hits {
+		switch {
+		case n > most:
+			tool, most = name, n
+		case n == most:
+			tool = DefaultTool
+		}
+	}
+	return tool, io.MultiReader(&read, br), nil
+}
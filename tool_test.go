@@ -0,0 +1,195 @@
+package revgrep
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckerAutoDetectFormat(t *testing.T) {
+	diff := []byte(`--- a/main.go
++++ b/main.go
+@@ -1,1 +1,1 @@
+-func Line() {}
++func NewLine() {}`)
+
+	tests := map[string]struct {
+		input    string
+		wantTool string
+		want     []Issue
+	}{
+		"golangci-lint": {
+			input:    "main.go:1:9: printf: bad format (govet)\n\tfunc NewLine() {}\n\t       ^\n",
+			wantTool: "golangci-lint",
+			want:     []Issue{{File: "main.go", LineNo: 1, ColNo: 9, HunkPos: 2, Issue: "main.go:1:9: printf: bad format (govet)", Message: "printf: bad format"}},
+		},
+		"vet": {
+			input:    "# example.com/pkg\n./main.go:1:9: bad format\n",
+			wantTool: "vet",
+			want:     []Issue{{File: "main.go", LineNo: 1, ColNo: 9, HunkPos: 2, Issue: "./main.go:1:9: bad format", Message: "bad format"}},
+		},
+		"dot-column": {
+			input:    "main.go:1.9: bad format\nmain.go:1: no column\n",
+			wantTool: "dot-column",
+			want:     []Issue{{File: "main.go", LineNo: 1, ColNo: 9, HunkPos: 2, Issue: "main.go:1.9: bad format", Message: "bad format"}},
+		},
+		"unknown": {
+			input:    "main.go:1:9: bad format\n",
+			wantTool: DefaultTool,
+			want:     []Issue{{File: "main.go", LineNo: 1, ColNo: 9, HunkPos: 2, Issue: "main.go:1:9: bad format", Message: "bad format"}},
+		},
+		"tie": {
+			input:    "main.go:1:9: bad format (govet)\n./main.go:1:9: bad format\n",
+			wantTool: DefaultTool,
+			want: []Issue{
+				{File: "main.go", LineNo: 1, ColNo: 9, HunkPos: 2, Issue: "main.go:1:9: bad format (govet)", Message: "bad format (govet)"},
+				{File: "main.go", LineNo: 1, ColNo: 9, HunkPos: 2, Issue: "./main.go:1:9: bad format", Message: "bad format"},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		tool, _, err := detectTool(strings.NewReader(test.input))
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", name, err)
+		}
+		if tool != test.wantTool {
+			t.Errorf("%v: unexpected tool: have %q want %q", name, tool, test.wantTool)
+		}
+
+		checker := Checker{
+			Patch:            bytes.NewReader(diff),
+			AutoDetectFormat: true,
+		}
+		issues, err := checker.Check(strings.NewReader(test.input), ioutil.Discard)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", name, err)
+		}
+		if !reflect.DeepEqual(issues, test.want) {
+			t.Errorf("%v: unexpected issues:\nhave: %#v\nwant: %#v", name, issues, test.want)
+		}
+	}
+}
+
+func TestCheckerUnknownTool(t *testing.T) {
+	checker := Checker{Patch: bytes.NewReader(nil), Tool: "unknown"}
+	if _, err := checker.Check(strings.NewReader(""), ioutil.Discard); err == nil {
+		t.Error("expected error for unknown tool")
+	}
+}
+
+func TestCheckerPreserveMessageWhitespace(t *testing.T) {
+	diff := []byte(`--- a/main.go
++++ b/main.go
+@@ -1,1 +1,1 @@
+-func Line() {}
++func NewLine() {}`)
+
+	tests := []struct {
+		tool     string
+		preserve bool
+		input    string
+		want     string
+	}{
+		{"", false, "main.go:1:9:     indented", "indented"},
+		{"", true, "main.go:1:9:     indented", "    indented"},
+		{"", true, "main.go:1: message", "message"},
+		{"vet", true, "./main.go:1:9:   indented", "  indented"},
+		{"golangci-lint", true, "main.go:1:9:   indented (govet)", "  indented"},
+	}
+
+	for _, test := range tests {
+		checker := Checker{
+			Patch:                     bytes.NewReader(diff),
+			Tool:                      test.tool,
+			PreserveMessageWhitespace: test.preserve,
+		}
+		issues, err := checker.Check(strings.NewReader(test.input+"\n"), ioutil.Discard)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.input, err)
+		}
+		if len(issues) != 1 || issues[0].Message != test.want {
+			t.Errorf("%q: unexpected issues: %#v, want message %q", test.input, issues, test.want)
+		}
+	}
+}
+
+func TestRegisterToolPattern(t *testing.T) {
+	if err := RegisterToolPattern("bad", `(`); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+	if err := RegisterToolPattern("bad", `(.*)`); err == nil {
+		t.Error("expected error for pattern without line")
+	}
+	if _, ok := toolPattern("bad"); ok {
+		t.Error("invalid pattern was registered")
+	}
+
+	err := RegisterToolPattern("custom", `^(?P<message>.*) at (?P<file>.*?\.go) line (?P<line>[0-9]+)$`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() {
+		toolMu.Lock()
+		delete(toolPatterns, "custom")
+		toolMu.Unlock()
+	}()
+
+	diff := []byte(`--- a/main.go
++++ b/main.go
+@@ -1,1 +1,1 @@
+-func Line() {}
++func NewLine() {}`)
+
+	for _, checker := range []Checker{
+		{Patch: bytes.NewReader(diff), Tool: "custom"},
+		{Patch: bytes.NewReader(diff), AutoDetectFormat: true},
+	} {
+		issues, err := checker.Check(strings.NewReader("bad format at main.go line 1\n"), ioutil.Discard)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []Issue{{File: "main.go", LineNo: 1, HunkPos: 2, Issue: "bad format at main.go line 1", Message: "bad format"}}
+		if !reflect.DeepEqual(issues, want) {
+			t.Errorf("unexpected issues:\nhave: %#v\nwant: %#v", issues, want)
+		}
+	}
+
+	// the pattern has no parts to rewrite for these options
+	for _, checker := range []Checker{
+		{Tool: "custom", PreserveMessageWhitespace: true},
+		{Tool: "custom", TolerantNumbers: true},
+	} {
+		if err := checker.Validate(); err == nil {
+			t.Errorf("%+v: expected error for unsupported option", checker)
+		}
+	}
+}
+
+func TestDetectToolRegisterToolPattern(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	go detectTool(r)
+	// wait for detectTool to block reading
+	w.Write([]byte("main.go:1: issue\n"))
+
+	registered := make(chan error)
+	go func() {
+		registered <- RegisterToolPattern("blocked", `(.*?\.go):([0-9]+)`)
+	}()
+	select {
+	case err := <-registered:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RegisterToolPattern blocked while detecting tool")
+	}
+	toolMu.Lock()
+	delete(toolPatterns, "blocked")
+	toolMu.Unlock()
+}
@@ -0,0 +1,151 @@
+package revgrep
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+)
+
+// VCS generates patches from a version control system.
+type VCS interface {
+	// Patch returns a patch and the list of new files, with the same
+	// semantics as GitPatch. If the current directory isn't within a
+	// repository of the VCS, nil is returned for the patch and error.
+	Patch(revisionFrom, revisionTo string) (io.Reader, []string, error)
+}
+
+// VCSFunc is an adapter to allow the use of a function as a VCS.
+type VCSFunc func(revisionFrom, revisionTo string) (io.Reader, []string, error)
+
+// Patch calls f(revisionFrom, revisionTo).
+func (f VCSFunc) Patch(revisionFrom, revisionTo string) (io.Reader, []string, error) {
+	return f(revisionFrom, revisionTo)
+}
+
+// DefaultVCSOrder is the order repositories are detected in when
+// Checker.VCSOrder isn't set.
+var DefaultVCSOrder = []string{"git", "hg"}
+
+var (
+	vcsMu sync.RWMutex
+	vcses = map[string]VCS{
+		"git": gitVCS{},
+		"hg":  VCSFunc(HgPatch),
+	}
+)
+
+// RegisterVCS makes a VCS available by name to Checker.VCSOrder, replacing
+// any VCS already registered with the same name.
+func RegisterVCS(name string, vcs VCS) {
+	vcsMu.Lock()
+	defer vcsMu.Unlock()
+	vcses[name] = vcs
+}
+
+// gitVCS is the built-in git VCS, whose patch is read by Checker with the
+// options which only apply to git, such as CacheDir.
+type gitVCS struct{}
+
+// Patch calls GitPatch(revisionFrom, revisionTo).
+func (gitVCS) Patch(revisionFrom, revisionTo string) (io.Reader, []string, error) {
+	return GitPatch(revisionFrom, revisionTo)
+}
+
+// vcsPatch sets Patch and NewFiles to the patch and new files from the first
+// VCS in VCSOrder which found a repository, and returns the VCS's name and
+// the revisions of the patch, if known. If no repository was found, Patch
+// isn't set and no error is returned.
+func (c *Checker) vcsPatch() (string, *Revisions, error) {
+	order := c.VCSOrder
+	if order == nil {
+		order = DefaultVCSOrder
+	}
+	for _, name := range order {
+		vcsMu.RLock()
+		vcs, ok := vcses[name]
+		vcsMu.RUnlock()
+		if !ok {
+			return name, nil, fmt.Errorf("unknown vcs: %q", name)
+		}
+		if _, ok := vcs.(gitVCS); ok {
+			if gitCommand(c.ReadOnlyGit, []string{"rev-parse", "--git-dir"}).Run() != nil {
+				continue
+			}
+			c.debugf("using vcs: %q", name)
+			revisions, err := c.readGitPatch()
+			return name, revisions, err
+		}
+
+		patch, newFiles, err := vcs.Patch(c.RevisionFrom, c.RevisionTo)
+		if err != nil || patch != nil {
+			c.debugf("using vcs: %q", name)
+			c.Patch, c.NewFiles = patch, newFiles
+			return name, nil, err
+		}
+	}
+	return "", nil, nil
+}
+
+// HgPatch returns a patch from a mercurial repository, with the same
+// semantics as GitPatch, except HEAD is the working directory's parent.
+func HgPatch(revisionFrom, revisionTo string) (io.Reader, []string, error) {
+	var patch bytes.Buffer
+
+	// check if hg repo exists
+	if err := exec.Command("hg", "root").Run(); err != nil {
+		// don't return an error, we assume the error is not repo exists
+		return nil, nil, nil
+	}
+
+	if revisionFrom != "" && revisionTo != "" {
+		cmd := exec.Command("hg", "diff", "--git", "-r", revisionFrom, "-r", revisionTo)
+		cmd.Stdout = &patch
+		if err := cmd.Run(); err != nil {
+			return nil, nil, fmt.Errorf("error executing hg diff %q %q: %s", revisionFrom, revisionTo, err)
+		}
+		return &patch, nil, nil
+	}
+
+	// make a patch for untracked files
+	var newFiles []string
+	ls, err := exec.Command("hg", "status", "--unknown", "--no-status").Output()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error executing hg status: %s", err)
+	}
+	for _, file := range bytes.Split(ls, []byte{'\n'}) {
+		if len(file) > 0 {
+			newFiles = append(newFiles, string(file))
+		}
+	}
+
+	if revisionFrom != "" {
+		cmd := exec.Command("hg", "diff", "--git", "-r", revisionFrom)
+		cmd.Stdout = &patch
+		if err := cmd.Run(); err != nil {
+			return nil, nil, fmt.Errorf("error executing hg diff %q: %s", revisionFrom, err)
+		}
+		return &patch, newFiles, nil
+	}
+
+	// make a patch for uncommitted changes
+	cmd := exec.Command("hg", "diff", "--git")
+	cmd.Stdout = &patch
+	if err := cmd.Run(); err != nil {
+		return nil, nil, fmt.Errorf("error executing hg diff: %s", err)
+	}
+
+	if patch.Len() > 0 || newFiles != nil {
+		return &patch, newFiles, nil
+	}
+
+	// check for changes in the working directory's parent
+	cmd = exec.Command("hg", "diff", "--git", "-c", ".")
+	cmd.Stdout = &patch
+	if err := cmd.Run(); err != nil {
+		return nil, nil, fmt.Errorf("error executing hg diff -c .: %s", err)
+	}
+
+	return &patch, nil, nil
+}
@@ -0,0 +1,241 @@
+package revgrep
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckerVCSOrder(t *testing.T) {
+	prevwd, sample := setup(t, "6-unstaged", "")
+	defer teardown(t, prevwd)
+
+	// colocate a stub hg repository, changing a different line than git
+	if err := os.Mkdir(".hg", 0755); err != nil {
+		t.Fatalf("could not create .hg: %v", err)
+	}
+	hg := VCSFunc(func(revisionFrom, revisionTo string) (io.Reader, []string, error) {
+		if _, err := os.Stat(".hg"); err != nil {
+			return nil, nil, nil
+		}
+		return strings.NewReader("--- a/main.go\n+++ b/main.go\n@@ -3,1 +3,1 @@\n+changed\n"), nil, nil
+	})
+	defer RegisterVCS("hg", VCSFunc(HgPatch))
+	RegisterVCS("hg", hg)
+
+	tests := []struct {
+		order []string
+		want  []int
+	}{
+		{nil, []int{6}},
+		{[]string{"git", "hg"}, []int{6}},
+		{[]string{"hg", "git"}, []int{3}},
+	}
+
+	for _, test := range tests {
+		checker := Checker{VCSOrder: test.order}
+		issues, err := checker.Check(bytes.NewReader(sample), ioutil.Discard)
+		if err != nil {
+			t.Errorf("order %v: unexpected error: %v", test.order, err)
+		}
+
+		var have []int
+		for _, issue := range issues {
+			have = append(have, issue.LineNo)
+		}
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("order %v: unexpected lines: have %v want %v", test.order, have, test.want)
+		}
+	}
+}
+
+func TestHgPatch(t *testing.T) {
+	if _, err := exec.LookPath("hg"); err != nil {
+		t.Skip("hg not installed")
+	}
+	dir, err := ioutil.TempDir("", "revgrep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// outside of a repository
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if patch, newFiles, err := HgPatch("", ""); patch != nil || newFiles != nil || err != nil {
+		t.Errorf("expected no patch outside repository, got: %v %v %v", patch, newFiles, err)
+	}
+
+	repo := filepath.Join(dir, "repo")
+	hg := func(args ...string) {
+		cmd := exec.Command("hg", args...)
+		cmd.Dir = repo
+		cmd.Env = append(os.Environ(), "HGPLAIN=1", "HGUSER=revgrep")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("could not run hg %v: %v: %s", args, err, out)
+		}
+	}
+	appendLine := func(file, line string) {
+		f, err := os.OpenFile(filepath.Join(repo, file), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(line + "\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// lines returns the line numbers added to each file in patch
+	lines := func(patch io.Reader) map[string][]int {
+		have := make(map[string][]int)
+		for file, changes := range (Checker{Patch: patch}).linesChanged() {
+			for _, p := range changes {
+				have[file] = append(have[file], p.lineNo)
+			}
+		}
+		return have
+	}
+
+	if err := os.Mkdir(repo, 0755); err != nil {
+		t.Fatal(err)
+	}
+	hg("init")
+	appendLine("main.go", "package main")
+	hg("add", "main.go")
+	hg("commit", "-m", "first")
+	appendLine("main.go", "var a = 1")
+	hg("commit", "-m", "second")
+	if err := os.Chdir(repo); err != nil {
+		t.Fatal(err)
+	}
+
+	// no uncommitted changes, so the working directory's parent is used
+	patch, newFiles, err := HgPatch("", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if have, want := lines(patch), map[string][]int{"main.go": {2}}; !reflect.DeepEqual(have, want) || newFiles != nil {
+		t.Errorf("unexpected changes in parent: have %v %q want %v", have, newFiles, want)
+	}
+
+	appendLine("main.go", "var b = 2")
+	appendLine("new.go", "package main")
+	tests := []struct {
+		from, to string
+		want     map[string][]int
+		newFiles []string
+	}{
+		{"", "", map[string][]int{"main.go": {3}}, []string{"new.go"}},
+		{"0", "", map[string][]int{"main.go": {2, 3}}, []string{"new.go"}},
+		{"0", "1", map[string][]int{"main.go": {2}}, nil},
+	}
+	for _, test := range tests {
+		patch, newFiles, err := HgPatch(test.from, test.to)
+		if err != nil {
+			t.Errorf("%q %q: unexpected error: %v", test.from, test.to, err)
+			continue
+		}
+		if have := lines(patch); !reflect.DeepEqual(have, test.want) {
+			t.Errorf("%q %q: unexpected changes: have %v want %v", test.from, test.to, have, test.want)
+		}
+		if !reflect.DeepEqual(newFiles, test.newFiles) {
+			t.Errorf("%q %q: unexpected new files: have %q want %q", test.from, test.to, newFiles, test.newFiles)
+		}
+	}
+}
+
+func TestCheckerGitOptionsOtherVCS(t *testing.T) {
+	RegisterVCS("other", VCSFunc(func(revisionFrom, revisionTo string) (io.Reader, []string, error) {
+		return strings.NewReader("--- a/main.go\n+++ b/main.go\n@@ -1,1 +1,2 @@\n line\n+added\n"), nil, nil
+	}))
+	defer func() {
+		vcsMu.Lock()
+		delete(vcses, "other")
+		vcsMu.Unlock()
+	}()
+
+	// options which only apply to git are ignored
+	var debug bytes.Buffer
+	checker := Checker{
+		VCSOrder:                []string{"other"},
+		RevisionFrom:            "1",
+		RevisionTo:              "2",
+		OnlyLastCommit:          true,
+		SquashAware:             true,
+		IncludeRevisionMetadata: true,
+		Format:                  "json",
+		Debug:                   &debug,
+	}
+	var out bytes.Buffer
+	issues, err := checker.Check(strings.NewReader("main.go:1: unchanged\nmain.go:2: added\n"), &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(issues) != 1 || issues[0].LineNo != 2 {
+		t.Errorf("unexpected issues: %#v", issues)
+	}
+	if strings.Contains(debug.String(), "merge base") || strings.Contains(debug.String(), "could not resolve revisions") {
+		t.Errorf("unexpected git commands run:\n%s", debug.String())
+	}
+	if strings.Contains(out.String(), `"revisions"`) {
+		t.Errorf("unexpected revisions: %s", out.String())
+	}
+}
+
+func TestCheckerUnknownVCS(t *testing.T) {
+	checker := Checker{VCSOrder: []string{"unknown"}}
+	_, err := checker.Check(strings.NewReader("file.go:1:issue\n"), ioutil.Discard)
+	if err == nil || !strings.Contains(err.Error(), "unknown vcs") {
+		t.Errorf("expected unknown vcs error, got: %v", err)
+	}
+}
+
+func TestCheckerEmptyInput(t *testing.T) {
+	var patched int
+	RegisterVCS("counting", VCSFunc(func(revisionFrom, revisionTo string) (io.Reader, []string, error) {
+		patched++
+		return strings.NewReader(""), nil, nil
+	}))
+	defer func() {
+		vcsMu.Lock()
+		delete(vcses, "counting")
+		vcsMu.Unlock()
+	}()
+
+	checker := Checker{VCSOrder: []string{"counting"}}
+	issues, err := checker.Check(strings.NewReader(""), ioutil.Discard)
+	if err != nil || issues != nil {
+		t.Errorf("unexpected issues %v or error: %v", issues, err)
+	}
+	if patched != 0 {
+		t.Errorf("expected no patch for empty input, got %d", patched)
+	}
+
+	var out bytes.Buffer
+	checker.Format = "json"
+	if _, err := checker.Check(strings.NewReader(""), &out); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if have, want := out.String(), "{\"issues\":[]}\n"; have != want {
+		t.Errorf("unexpected output: have %q want %q", have, want)
+	}
+
+	if _, err := checker.Check(strings.NewReader("file.go:1:issue\n"), ioutil.Discard); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if patched != 1 {
+		t.Errorf("expected patch for input, got %d", patched)
+	}
+}